@@ -1,6 +1,7 @@
 package backfill
 
 import (
+	"context"
 	"github.com/clambin/covid19/models"
 	"golang.org/x/exp/slog"
 	"time"
@@ -13,12 +14,12 @@ type Backfiller struct {
 }
 
 type CovidStoreAdder interface {
-	Add([]models.CountryEntry) error
+	Add(context.Context, []models.CountryEntry) error
 }
 
 type CovidGetter interface {
-	GetCountries() (Countries, error)
-	GetHistoricalData(string) ([]CountryData, error)
+	GetCountries(context.Context) (Countries, error)
+	GetHistoricalData(context.Context, string) ([]CountryData, error)
 }
 
 // New creates a new Backfiller object
@@ -30,36 +31,42 @@ func New(store CovidStoreAdder) *Backfiller {
 
 // Run the backfiller.  Get all supported countries from the API
 // Then add any historical record that is older than the first
-// record in the DB
-func (b *Backfiller) Run() error {
+// record in the DB. Run stops when the context is canceled.
+func (b *Backfiller) Run(ctx context.Context) error {
 
-	countries, err := b.Client.GetCountries()
+	countries, err := b.Client.GetCountries(ctx)
 	if err != nil {
 		return err
 	}
 
 	for slug, details := range countries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		realName := lookupCountryName(details.Name)
 		slog.Debug("Getting country data", "name", realName, "slug", slug)
 
 		var entries []CountryData
-		if entries, err = b.Client.GetHistoricalData(slug); err != nil {
+		if entries, err = b.Client.GetHistoricalData(ctx, slug); err != nil {
 			slog.Error("failed to get history", "err", err, "country", slug)
 			continue
 		}
 
 		var records []models.CountryEntry
 		for _, entry := range entries {
+			// historical figures are dated by the day they cover. Store them as if they were published at the end of that day
+			timestamp := entry.Date.UTC().Add(24 * time.Hour)
 			records = append(records, models.CountryEntry{
-				Timestamp: entry.Date.Add(24 * time.Hour),
-				Code:      details.Code,
-				Name:      realName,
-				Confirmed: entry.Confirmed,
-				Deaths:    entry.Deaths,
-				Recovered: entry.Recovered})
+				Timestamp:  timestamp,
+				ReportDate: models.ReportDate(timestamp),
+				Code:       details.Code,
+				Name:       realName,
+				Confirmed:  entry.Confirmed,
+				Deaths:     entry.Deaths,
+				Recovered:  entry.Recovered})
 		}
 
-		if err = b.Store.Add(records); err == nil {
+		if err = b.Store.Add(ctx, records); err == nil {
 			slog.Info("Received country data ", "name", realName, "count", len(records))
 		}
 	}
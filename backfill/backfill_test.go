@@ -1,6 +1,7 @@
 package backfill_test
 
 import (
+	"context"
 	"github.com/clambin/covid19/backfill"
 	"github.com/clambin/covid19/internal/testtools/db/covid"
 	"github.com/clambin/covid19/models"
@@ -20,17 +21,32 @@ func TestBackfiller_Run(t *testing.T) {
 	backFiller := backfill.New(&store)
 	backFiller.Client = backfill.Client{URL: server.URL}
 
-	err := backFiller.Run()
+	err := backFiller.Run(context.Background())
 	require.NoError(t, err)
 
-	content, _ := store.GetAllForRange(time.Time{}, time.Time{})
+	content, _ := store.GetAllForRange(context.Background(), time.Time{}, time.Time{})
 	assert.Equal(t, []models.CountryEntry{
-		{Timestamp: time.Date(2020, time.January, 23, 0, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 0, Recovered: 0, Deaths: 0},
-		{Timestamp: time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC), Code: "MM", Name: "Burma", Confirmed: 8, Recovered: 0, Deaths: 0},
-		{Timestamp: time.Date(2020, time.February, 5, 0, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 1, Recovered: 0, Deaths: 0},
+		{Timestamp: time.Date(2020, time.January, 23, 0, 0, 0, 0, time.UTC), ReportDate: time.Date(2020, time.January, 22, 0, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 0, Recovered: 0, Deaths: 0},
+		{Timestamp: time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC), ReportDate: time.Date(2020, time.January, 31, 0, 0, 0, 0, time.UTC), Code: "MM", Name: "Burma", Confirmed: 8, Recovered: 0, Deaths: 0},
+		{Timestamp: time.Date(2020, time.February, 5, 0, 0, 0, 0, time.UTC), ReportDate: time.Date(2020, time.February, 4, 0, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 1, Recovered: 0, Deaths: 0},
 	}, content)
 }
 
+func TestBackfiller_Run_Canceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(covidAPI))
+	defer server.Close()
+	store := covid.FakeStore{}
+
+	backFiller := backfill.New(&store)
+	backFiller.Client = backfill.Client{URL: server.URL}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := backFiller.Run(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, store.Records)
+}
+
 // covidAPI emulates the Covid API Server
 func covidAPI(w http.ResponseWriter, req *http.Request) {
 	response, ok := goodResponse[req.URL.Path]
@@ -1,9 +1,11 @@
 package backfill
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/clambin/covid19/pkg/retry"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"io"
 	"net/http"
 	"time"
@@ -24,17 +26,17 @@ const maxRetries = 10
 
 var MaxRetries = maxRetries
 
-func (c Client) GetCountries() (Countries, error) {
+func (c Client) GetCountries(ctx context.Context) (Countries, error) {
 	r := makeRetry()
-	httpClient := http.Client{Timeout: 10 * time.Second}
+	httpClient := newHTTPClient()
 
 	var stats []struct {
 		Country string
 		Slug    string
 		ISO2    string
 	}
-	err := r.Do(func() error {
-		req, _ := http.NewRequest(http.MethodGet, c.URL+"/countries", nil)
+	err := r.DoWithContext(ctx, func() error {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, c.URL+"/countries", nil)
 		resp, err := httpClient.Do(req)
 		if err != nil {
 			return err
@@ -70,13 +72,13 @@ type CountryData struct {
 	Deaths    int64
 }
 
-func (c Client) GetHistoricalData(slug string) ([]CountryData, error) {
+func (c Client) GetHistoricalData(ctx context.Context, slug string) ([]CountryData, error) {
 	r := makeRetry()
-	httpClient := http.Client{Timeout: 10 * time.Second}
+	httpClient := newHTTPClient()
 
 	var stats []CountryData
-	err := r.Do(func() error {
-		req, _ := http.NewRequest(http.MethodGet, c.URL+"/total/country/"+slug, nil)
+	err := r.DoWithContext(ctx, func() error {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, c.URL+"/total/country/"+slug, nil)
 		resp, err := httpClient.Do(req)
 		if err != nil {
 			return err
@@ -94,6 +96,11 @@ func (c Client) GetHistoricalData(slug string) ([]CountryData, error) {
 	return stats, err
 }
 
+// newHTTPClient creates an HTTP client that records a span for each request
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: 10 * time.Second, Transport: otelhttp.NewTransport(http.DefaultTransport)}
+}
+
 func makeRetry() *retry.Retry {
 	return &retry.Retry{
 		BackOff: retry.NewDoublerBackoff(MaxRetries, 250*time.Millisecond, 5*time.Second),
@@ -1,6 +1,7 @@
 package backfill_test
 
 import (
+	"context"
 	"github.com/clambin/covid19/backfill"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -15,7 +16,7 @@ func TestClient_GetCountries(t *testing.T) {
 	defer s.Close()
 	c := backfill.Client{URL: s.URL}
 
-	countries, err := c.GetCountries()
+	countries, err := c.GetCountries(context.Background())
 	require.NoError(t, err)
 	assert.Equal(t, backfill.Countries{
 		"belgium": backfill.Country{Name: "Belgium", Code: "BE"},
@@ -61,7 +62,7 @@ func TestClient_GetHistoricalData(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			data, err := c.GetHistoricalData(tt.slug)
+			data, err := c.GetHistoricalData(context.Background(), tt.slug)
 			tt.wantErr(t, err)
 			assert.Equal(t, tt.want, data)
 		})
@@ -76,6 +77,6 @@ func TestClient_GetHistoricalData_TooManyRequests(t *testing.T) {
 	c := backfill.Client{URL: s.URL}
 
 	backfill.MaxRetries = 2
-	_, err := c.GetHistoricalData("belgium")
+	_, err := c.GetHistoricalData(context.Background(), "belgium")
 	assert.Error(t, err)
 }
@@ -1,35 +1,51 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/clambin/covid19/configuration"
 	"github.com/clambin/covid19/stack"
+	"github.com/clambin/covid19/tracing"
 	"github.com/clambin/covid19/version"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/exp/slog"
 	"gopkg.in/alecthomas/kingpin.v2"
-	"net/http"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	// quiet hours may be configured in any time zone
+	_ "time/tzdata"
 )
 
 func main() {
 	cmd, cfg, err := GetConfiguration("covid19", os.Args)
 	if err != nil {
-		panic(fmt.Errorf("failed to initialize application: %w", err))
+		printConfigurationError(err)
+		os.Exit(1)
 	}
 
-	var opts slog.HandlerOptions
-	if cfg.Debug {
-		opts.Level = slog.LevelDebug
-		opts.AddSource = true
+	if cmd == checkConfigCmd.FullCommand() {
+		fmt.Println("configuration is valid")
+		return
 	}
+
+	var logLevel slog.LevelVar
+	logLevel.Set(stack.LogLevel(cfg.Debug))
+	opts := slog.HandlerOptions{Level: &logLevel, AddSource: cfg.Debug}
 	slog.SetDefault(slog.New(opts.NewTextHandler(os.Stdout)))
 
 	slog.Info("covid19 starting", "version", version.BuildVersion)
 
+	if strings.HasPrefix(cmd, dbCmd.FullCommand()+" ") {
+		// maintenance commands control the migrations themselves
+		cfg.Postgres.AutoMigrate = false
+	}
+
 	var s *stack.Stack
 	if s, err = stack.CreateStack(cfg); err != nil {
 		slog.Error("app init failed", "err", err)
@@ -37,45 +53,168 @@ func main() {
 	}
 	prometheus.DefaultRegisterer.MustRegister(s)
 
+	shutdownTracing, err := tracing.Start(context.Background(), cfg.Tracing)
+	if err != nil {
+		slog.Error("failed to start tracing", "err", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err = run(ctx, cmd, cfg, s, &logLevel)
+	stop()
+
+	// flush the remaining spans, also when the command failed
+	tracingCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if shutdownErr := shutdownTracing(tracingCtx); shutdownErr != nil {
+		slog.Warn("failed to flush traces", "err", shutdownErr)
+	}
+
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, cmd string, cfg *configuration.Configuration, s *stack.Stack, logLevel *slog.LevelVar) error {
+	var err error
 	switch cmd {
 	case handlerCmd.FullCommand():
-		go runPrometheusServer(cfg.PrometheusPort)
-		if err = s.RunHandler(); !errors.Is(err, http.ErrServerClosed) {
-			slog.Error("failed to start simplejson handler", "err", err)
-			os.Exit(1)
+		reloader := stack.NewReloader(loader.filename, cfg, loader.load, logLevel)
+		prometheus.DefaultRegisterer.MustRegister(reloader)
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go reloader.Run(ctx, hup)
+		if err = s.RunHandler(ctx); err != nil {
+			slog.Error("simplejson handler failed", "err", err)
 		}
 	case loaderCmd.FullCommand():
-		s.Load()
+		err = s.Load(ctx)
 	case populationLoaderCmd.FullCommand():
-		s.LoadPopulation()
+		err = s.LoadPopulation(ctx)
+	case runsListCmd.FullCommand():
+		if err = s.ListRuns(ctx, os.Stdout, runsLimit); err != nil {
+			slog.Error("failed to list runs", "err", err)
+		}
+	case runsRollbackCmd.FullCommand():
+		if err = s.Rollback(ctx, runsRollbackID); err != nil {
+			slog.Error("failed to roll back run", "err", err, "id", runsRollbackID)
+		}
+	case migrateUpCmd.FullCommand(), migrateDownCmd.FullCommand(), migrateToCmd.FullCommand(), migrateStatusCmd.FullCommand():
+		if err = migrate(ctx, cmd, s); err != nil {
+			slog.Error("database maintenance failed", "err", err, "command", cmd)
+		}
+	case compactCmd.FullCommand():
+		if err = s.Compact(ctx); err != nil {
+			slog.Error("database maintenance failed", "err", err, "command", cmd)
+		}
+	case backupCmd.FullCommand():
+		if err = s.Backup(ctx, backupFile); err != nil {
+			slog.Error("database maintenance failed", "err", err, "command", cmd)
+		}
+	case restoreCmd.FullCommand():
+		if err = s.Restore(ctx, backupFile); err != nil {
+			slog.Error("database maintenance failed", "err", err, "command", cmd)
+		}
 	default:
 		slog.Warn("invalid command", "command", cmd)
 	}
+	return err
+}
+
+func migrate(ctx context.Context, cmd string, s *stack.Stack) error {
+	switch cmd {
+	case migrateUpCmd.FullCommand():
+		return s.MigrateUp(ctx)
+	case migrateDownCmd.FullCommand():
+		if migrateAll {
+			return s.MigrateDown(ctx, 0)
+		}
+		if migrateSteps == 0 {
+			return errors.New("use --all to roll back all migrations")
+		}
+		return s.MigrateDown(ctx, migrateSteps)
+	case migrateToCmd.FullCommand():
+		return s.MigrateTo(ctx, migrateVersion)
+	default:
+		return s.MigrationStatus(ctx, os.Stdout)
+	}
 }
 
 var (
 	handlerCmd          *kingpin.CmdClause
 	loaderCmd           *kingpin.CmdClause
 	populationLoaderCmd *kingpin.CmdClause
+	checkConfigCmd      *kingpin.CmdClause
+	runsListCmd         *kingpin.CmdClause
+	runsRollbackCmd     *kingpin.CmdClause
+	runsLimit           int
+	runsRollbackID      int64
+	dbCmd               *kingpin.CmdClause
+	migrateUpCmd        *kingpin.CmdClause
+	migrateDownCmd      *kingpin.CmdClause
+	migrateToCmd        *kingpin.CmdClause
+	migrateStatusCmd    *kingpin.CmdClause
+	migrateSteps        uint
+	migrateAll          bool
+	migrateVersion      uint
+	compactCmd          *kingpin.CmdClause
+	backupCmd           *kingpin.CmdClause
+	restoreCmd          *kingpin.CmdClause
+	backupFile          string
+	loader              configLoader
 )
 
-// GetConfiguration parses the provided commandline arguments and creates the required configuration
-func GetConfiguration(application string, args []string) (cmd string, cfg *configuration.Configuration, err error) {
-	var (
-		debug          bool
-		configFileName string
+// configLoader loads the configuration file, with the overrides provided through the environment and the command line
+type configLoader struct {
+	filename string
+	settings []string
+	debug    bool
+}
+
+func (l configLoader) load(content io.Reader) (*configuration.Configuration, error) {
+	cfg, err := configuration.LoadConfiguration(content,
+		configuration.FromEnvironment(os.Environ()),
+		configuration.FromSettings(l.settings),
 	)
+	if err == nil && l.debug {
+		cfg.Debug = true
+	}
+	return cfg, err
+}
 
+// GetConfiguration parses the provided commandline arguments and creates the required configuration
+func GetConfiguration(application string, args []string) (cmd string, cfg *configuration.Configuration, err error) {
 	a := kingpin.New(filepath.Base(args[0]), application)
 
 	a.Version(version.BuildVersion)
 	a.HelpFlag.Short('h')
 	a.VersionFlag.Short('v')
-	a.Flag("debug", "Log debug messages").BoolVar(&debug)
-	a.Flag("config", "Configuration file").Required().ExistingFileVar(&configFileName)
+	a.Flag("debug", "Log debug messages").BoolVar(&loader.debug)
+	a.Flag("config", "Configuration file").Required().ExistingFileVar(&loader.filename)
+	a.Flag("set", "Override a field of the configuration file, e.g. --set postgres.host=localhost (repeatable)").PlaceHolder("FIELD=VALUE").StringsVar(&loader.settings)
 	handlerCmd = a.Command("handler", "runs the simplejson handler")
 	loaderCmd = a.Command("loader", "retrieves new covid data")
 	populationLoaderCmd = a.Command("population", "retrieves latest population data")
+	checkConfigCmd = a.Command("check-config", "validates the configuration file, without accessing the database")
+	runsCmd := a.Command("runs", "manages the audit log of the loader runs")
+	runsListCmd = runsCmd.Command("list", "lists the most recent runs")
+	runsListCmd.Flag("limit", "Maximum number of runs to list (0: all)").Default("20").IntVar(&runsLimit)
+	runsRollbackCmd = runsCmd.Command("rollback", "deletes all covid19 figures added by a run")
+	runsRollbackCmd.Arg("id", "Run ID, as listed by 'runs list'").Required().Int64Var(&runsRollbackID)
+	dbCmd = a.Command("db", "database maintenance")
+	migrateCmd := dbCmd.Command("migrate", "manages the database schema")
+	migrateUpCmd = migrateCmd.Command("up", "applies all pending migrations")
+	migrateDownCmd = migrateCmd.Command("down", "rolls back the most recent migrations")
+	migrateDownCmd.Arg("steps", "Number of migrations to roll back").Default("1").UintVar(&migrateSteps)
+	migrateDownCmd.Flag("all", "Roll back all migrations. This deletes all tables!").BoolVar(&migrateAll)
+	migrateToCmd = migrateCmd.Command("to", "applies or rolls back migrations until the schema is at the provided version")
+	migrateToCmd.Arg("version", "Schema version").Required().UintVar(&migrateVersion)
+	migrateStatusCmd = migrateCmd.Command("status", "shows the schema version and the number of pending migrations")
+	compactCmd = dbCmd.Command("compact", "keeps only the last covid19 entry per country per day for days older than retention.downsampleAfter")
+	backupCmd = dbCmd.Command("backup", "writes the covid19 and population tables to an archive")
+	backupCmd.Arg("file", "Archive file. Must not exist").Required().StringVar(&backupFile)
+	restoreCmd = dbCmd.Command("restore", "loads an archive written by 'db backup' into an empty database")
+	restoreCmd.Arg("file", "Archive file").Required().ExistingFileVar(&backupFile)
 
 	cmd, err = a.Parse(args[1:])
 	if err != nil {
@@ -83,25 +222,37 @@ func GetConfiguration(application string, args []string) (cmd string, cfg *confi
 	}
 
 	var f *os.File
-	if f, err = os.OpenFile(configFileName, os.O_RDONLY, 0); err != nil {
+	if f, err = os.OpenFile(loader.filename, os.O_RDONLY, 0); err != nil {
 		return "", nil, fmt.Errorf("configuration: %w", err)
 	}
 	defer func() { _ = f.Close() }()
 
-	if cfg, err = configuration.LoadConfiguration(f); err != nil {
+	if cfg, err = loader.load(f); err != nil {
 		return "", nil, fmt.Errorf("load configuration: %w", err)
 	}
 
-	if debug {
-		cfg.Debug = true
+	// some fields are only required by the commands that use them
+	switch cmd {
+	case loaderCmd.FullCommand():
+		err = cfg.ValidateLoader()
+	case populationLoaderCmd.FullCommand():
+		err = cfg.ValidatePopulation()
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("load configuration: %w", err)
 	}
 
 	return
 }
 
-func runPrometheusServer(port int) {
-	http.Handle("/metrics", promhttp.Handler())
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil); !errors.Is(err, http.ErrServerClosed) {
-		slog.Error("failed to start Prometheus listener", "err", err)
+func printConfigurationError(err error) {
+	var validationErr *configuration.ValidationError
+	if !errors.As(err, &validationErr) {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to initialize application: %s\n", err)
+		return
+	}
+	_, _ = fmt.Fprintln(os.Stderr, "invalid configuration:")
+	for _, fieldErr := range validationErr.Errors {
+		_, _ = fmt.Fprintf(os.Stderr, "  %s\n", fieldErr)
 	}
 }
@@ -0,0 +1,183 @@
+package configuration
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is the prefix of the environment variables that override the configuration file
+const EnvPrefix = "COVID19_CFG_"
+
+// Override changes a loaded configuration, before it is validated
+type Override func(*Configuration) error
+
+var errUnknownField = errors.New("unknown field")
+
+// FromEnvironment overrides the configuration with all environment variables starting with EnvPrefix. The name of the
+// variable is the path of the field in the configuration file, in uppercase, with dots and indices replaced by
+// underscores. E.g. COVID19_CFG_POSTGRES_HOST sets postgres.host and COVID19_CFG_MONITOR_NOTIFICATIONS_ROUTES_0_URL sets the
+// url of the first route. If the name ends in _FILE, the field is set to the content of the file with that name.
+//
+// The prefix doesn't collide with the service links Kubernetes adds for a service called covid19 (COVID19_PORT,
+// COVID19_SERVICE_HOST, ...). Variables that don't match a field are ignored.
+func FromEnvironment(environ []string) Override {
+	return func(cfg *Configuration) error {
+		var v validator
+		for _, env := range environ {
+			name, value, _ := strings.Cut(env, "=")
+			if !strings.HasPrefix(name, EnvPrefix) {
+				continue
+			}
+			path := strings.Split(strings.TrimPrefix(name, EnvPrefix), "_")
+			err := cfg.set(path, value)
+			if errors.Is(err, errUnknownField) && len(path) > 1 && path[len(path)-1] == "FILE" {
+				err = cfg.setFromFile(path[:len(path)-1], value)
+			}
+			if err != nil && !errors.Is(err, errUnknownField) {
+				v.add(name, err)
+			}
+		}
+		return v.err()
+	}
+}
+
+// FromSettings overrides the configuration with a list of field=value settings, as provided on the command line.
+// The field is the path of the field in the configuration file, e.g. postgres.host or monitor.notifications.routes[0].url.
+func FromSettings(settings []string) Override {
+	return func(cfg *Configuration) error {
+		var v validator
+		for _, setting := range settings {
+			field, value, found := strings.Cut(setting, "=")
+			if !found {
+				v.addf(setting, "invalid setting: expected field=value")
+				continue
+			}
+			path := strings.Split(strings.NewReplacer("[", ".", "]", "").Replace(field), ".")
+			if err := cfg.set(path, value); err != nil {
+				v.add(field, err)
+			}
+		}
+		return v.err()
+	}
+}
+
+func (c *Configuration) set(path []string, value string) error {
+	return setField(reflect.ValueOf(c).Elem(), path, value)
+}
+
+func (c *Configuration) setFromFile(path []string, filename string) error {
+	value, err := readSecret(filename)
+	if err == nil {
+		err = c.set(path, value)
+	}
+	return err
+}
+
+// setField sets the field of v with the provided path. Each element of the path is a yaml field name (case-insensitive)
+// or, for lists of structures, the index of an existing entry.
+func setField(v reflect.Value, path []string, value string) error {
+	if len(path) == 0 {
+		return setValue(v, value)
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+			if strings.EqualFold(name, path[0]) {
+				return setField(v.Field(i), path[1:], value)
+			}
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Struct {
+			if idx, err := strconv.Atoi(path[0]); err == nil && idx >= 0 && idx < v.Len() {
+				return setField(v.Index(idx), path[1:], value)
+			}
+		}
+	}
+	return errUnknownField
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setValue(v reflect.Value, value string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		v.SetInt(i)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return errors.New("cannot be overridden")
+		}
+		var values []string
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
+		v.Set(reflect.ValueOf(values))
+	default:
+		return errors.New("cannot be overridden")
+	}
+	return nil
+}
+
+// readSecrets sets the secrets configured as files
+func (c *Configuration) readSecrets() error {
+	var v validator
+	readSecretFile(&v, "postgres.password", &c.Postgres.Password, c.Postgres.PasswordFile)
+	readSecretFile(&v, "monitor.rapidAPIKey", &c.Monitor.RapidAPIKey, c.Monitor.RapidAPIKeyFile)
+	return v.err()
+}
+
+func readSecretFile(v *validator, field string, value *string, filename string) {
+	if filename == "" {
+		return
+	}
+	if *value != "" {
+		v.addf(field+"File", "cannot be combined with %s", field)
+		return
+	}
+	var err error
+	if *value, err = readSecret(filename); err != nil {
+		v.add(field+"File", err)
+	}
+}
+
+// readSecret returns the content of a file, without trailing newlines, as written by most editors and by Kubernetes secrets
+func readSecret(filename string) (string, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
@@ -0,0 +1,123 @@
+package configuration_test
+
+import (
+	"bytes"
+	"github.com/clambin/covid19/configuration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const overrideConfig = `
+postgres:
+  host: localhost
+  password: some-password
+monitor:
+  rapidAPIKey: some-key
+  notifications:
+    routes:
+      - name: us-team
+        url: generic+https://example.com/123
+        countries: [US]
+port: 8080
+`
+
+func TestLoadConfiguration_Overrides(t *testing.T) {
+	cfg, err := configuration.LoadConfiguration(bytes.NewBufferString(overrideConfig),
+		configuration.FromEnvironment([]string{
+			"COVID19_CFG_POSTGRES_HOST=postgres.example.com",
+			"COVID19_CFG_POSTGRES_PASSWORD=pa$$word",
+			"COVID19_CFG_PORT=8081",
+			"COVID19_CFG_MONITOR_NOTIFICATIONS_ROUTES_0_ENABLED=true",
+			"COVID19_CFG_MONITOR_NOTIFICATIONS_ROUTES_0_COUNTRIES=Belgium, US",
+			// service links of a Kubernetes service called covid19
+			"COVID19_PORT=tcp://10.0.0.1:8080",
+			"COVID19_SERVICE_HOST=10.0.0.1",
+			"HOME=/root",
+		}),
+		configuration.FromSettings([]string{
+			"port=8082",
+			"monitor.notifications.routes[0].url=generic+https://example.com/456",
+			"postgres.autoMigrate=false",
+			"postgres.migrationLockTimeout=1m",
+		}),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, "postgres.example.com", cfg.Postgres.Host)
+	assert.Equal(t, "pa$$word", cfg.Postgres.Password)
+	assert.Equal(t, 8082, cfg.Port)
+	assert.False(t, cfg.Postgres.AutoMigrate)
+	assert.Equal(t, time.Minute, cfg.Postgres.MigrationLockTimeout)
+	require.Len(t, cfg.Monitor.Notifications.Routes, 1)
+	assert.Equal(t, configuration.RouteConfiguration{
+		Name:      "us-team",
+		Countries: []string{"Belgium", "US"},
+		URL:       "generic+https://example.com/456",
+		Enabled:   true,
+	}, cfg.Monitor.Notifications.Routes[0])
+}
+
+func TestLoadConfiguration_Overrides_Errors(t *testing.T) {
+	_, err := configuration.LoadConfiguration(bytes.NewBufferString(overrideConfig),
+		configuration.FromEnvironment([]string{
+			"COVID19_CFG_PORT=tcp://10.0.0.1:8080",
+			"COVID19_CFG_DEBUG=maybe",
+			"COVID19_CFG_MONITOR_ALERTS=foo",
+			"COVID19_CFG_POSTGRES_PASSWORD_FILE=/not/a/file",
+			"COVID19_CFG_POSTGRES_MIGRATIONLOCKTIMEOUT=15",
+		}),
+	)
+	var validationErr *configuration.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []string{"COVID19_CFG_PORT", "COVID19_CFG_DEBUG", "COVID19_CFG_MONITOR_ALERTS", "COVID19_CFG_POSTGRES_PASSWORD_FILE", "COVID19_CFG_POSTGRES_MIGRATIONLOCKTIMEOUT"}, fields(validationErr))
+
+	_, err = configuration.LoadConfiguration(bytes.NewBufferString(overrideConfig),
+		configuration.FromSettings([]string{"postgres.hots=localhost", "port", "monitor.notifications.routes[1].url=foo"}),
+	)
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []string{"postgres.hots", "port", "monitor.notifications.routes[1].url"}, fields(validationErr))
+}
+
+func TestLoadConfiguration_Secrets(t *testing.T) {
+	tmpDir := t.TempDir()
+	passwordFile := filepath.Join(tmpDir, "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("pa$$word\n"), 0600))
+	keyFile := filepath.Join(tmpDir, "key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("some-other-key\n"), 0600))
+
+	cfg, err := configuration.LoadConfiguration(bytes.NewBufferString(`
+postgres:
+  passwordFile: `+passwordFile+`
+monitor:
+  rapidAPIKey: "literal $$ sign"
+`),
+		configuration.FromEnvironment([]string{"COVID19_CFG_MONITOR_RAPIDAPIKEY_FILE=" + keyFile}),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "pa$$word", cfg.Postgres.Password)
+	assert.Equal(t, "some-other-key", cfg.Monitor.RapidAPIKey)
+
+	cfg, err = configuration.LoadConfiguration(bytes.NewBufferString(`
+postgres:
+  password: some-password
+monitor:
+  rapidAPIKey: "literal $$ sign"
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "literal $ sign", cfg.Monitor.RapidAPIKey)
+
+	_, err = configuration.LoadConfiguration(bytes.NewBufferString(`
+postgres:
+  password: some-password
+  passwordFile: ` + passwordFile + `
+monitor:
+  rapidAPIKeyFile: /not/a/file
+`))
+	var validationErr *configuration.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []string{"postgres.passwordFile", "monitor.rapidAPIKeyFile"}, fields(validationErr))
+}
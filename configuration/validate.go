@@ -0,0 +1,292 @@
+package configuration
+
+import (
+	"fmt"
+	"github.com/clambin/covid19/covid/alert"
+	"github.com/clambin/covid19/covid/notification"
+	"github.com/clambin/covid19/covid/shoutrrr"
+	"net/url"
+	"strings"
+)
+
+// FieldError reports an invalid field of the configuration
+type FieldError struct {
+	// Field is the path of the field in the configuration file, e.g. "monitor.notifications.routes[1].url"
+	Field string
+	Err   error
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+func (e FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError lists all invalid fields of a configuration
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	errs := make([]string, len(e.Errors))
+	for idx, err := range e.Errors {
+		errs[idx] = err.Error()
+	}
+	return "invalid configuration: " + strings.Join(errs, "; ")
+}
+
+type validator struct {
+	errors []FieldError
+}
+
+func (v *validator) add(field string, err error) {
+	v.errors = append(v.errors, FieldError{Field: field, Err: err})
+}
+
+func (v *validator) addf(field string, format string, args ...any) {
+	v.add(field, fmt.Errorf(format, args...))
+}
+
+func (v *validator) err() error {
+	if len(v.errors) > 0 {
+		return &ValidationError{Errors: v.errors}
+	}
+	return nil
+}
+
+func (v *validator) required(field string, value string) {
+	if value == "" {
+		v.addf(field, "required")
+	}
+}
+
+// Validate checks the configuration. If it is invalid, Validate returns a ValidationError listing all invalid fields
+func (c Configuration) Validate() error {
+	var v validator
+	c.Postgres.validate(&v, "postgres")
+	c.Monitor.validate(&v, "monitor")
+	validatePort(&v, "port", c.Port)
+	validatePort(&v, "prometheusPort", c.PrometheusPort)
+	c.Tracing.validate(&v, "tracing")
+	c.LoaderMetrics.validate(&v, "loaderMetrics")
+	nonNegative(&v, "retention.downsampleAfter", int64(c.Retention.DownsampleAfter))
+	return v.err()
+}
+
+// ValidateLoader checks the fields that the loader command needs, in addition to the ones checked by Validate
+func (c Configuration) ValidateLoader() error {
+	var v validator
+	v.required("monitor.rapidAPIKey", c.Monitor.RapidAPIKey)
+	return v.err()
+}
+
+// ValidatePopulation checks the fields that the population command needs, in addition to the ones checked by Validate.
+// The RapidAPI key is only needed if the figures aren't imported from monitor.population.file.
+func (c Configuration) ValidatePopulation() error {
+	var v validator
+	if c.Monitor.Population.File == "" {
+		v.required("monitor.rapidAPIKey", c.Monitor.RapidAPIKey)
+	}
+	return v.err()
+}
+
+func (t TracingConfiguration) validate(v *validator, path string) {
+	switch t.Exporter {
+	case "", TracingExporterOTLP, TracingExporterStdout:
+	default:
+		v.addf(path+".exporter", "invalid exporter %q", t.Exporter)
+	}
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		v.addf(path+".sampleRatio", "must be between 0 and 1")
+	}
+}
+
+func (l LoaderMetrics) validate(v *validator, path string) {
+	if l.PushGateway == "" {
+		return
+	}
+	if u, err := url.Parse(l.PushGateway); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.addf(path+".pushGateway", "invalid url %q", l.PushGateway)
+	}
+}
+
+func validatePort(v *validator, field string, port int) {
+	if port <= 0 || port > 65535 {
+		v.addf(field, "invalid port %d", port)
+	}
+}
+
+func (pg PostgresDB) validate(v *validator, path string) {
+	v.required(path+".host", pg.Host)
+	validatePort(v, path+".port", pg.Port)
+	v.required(path+".database", pg.Database)
+	v.required(path+".user", pg.User)
+	// the password is optional: the server may authenticate the client certificate (sslCert/sslKey), or trust the client
+	nonNegative(v, path+".migrationLockTimeout", int64(pg.MigrationLockTimeout))
+	switch pg.SSLMode {
+	case "", SSLModeDisable, SSLModeRequire, SSLModeVerifyCA, SSLModeVerifyFull:
+	default:
+		v.addf(path+".sslMode", "invalid sslMode %q", pg.SSLMode)
+	}
+	if (pg.SSLCert == "") != (pg.SSLKey == "") {
+		v.addf(path+".sslKey", "sslCert and sslKey must be set together")
+	}
+	nonNegative(v, path+".connectTimeout", int64(pg.ConnectTimeout))
+	nonNegative(v, path+".connectRetries", int64(pg.ConnectRetries))
+	nonNegative(v, path+".maxOpenConns", int64(pg.MaxOpenConns))
+	nonNegative(v, path+".maxIdleConns", int64(pg.MaxIdleConns))
+	nonNegative(v, path+".connMaxLifetime", int64(pg.ConnMaxLifetime))
+	if strings.Contains(pg.Replica, "://") {
+		if u, err := url.Parse(pg.Replica); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") || u.Host == "" {
+			// don't report the connection string: it may contain a password
+			v.addf(path+".replica", "invalid url")
+		}
+	}
+}
+
+func nonNegative(v *validator, field string, value int64) {
+	if value < 0 {
+		v.addf(field, "must not be negative")
+	}
+}
+
+func (m MonitorConfiguration) validate(v *validator, path string) {
+	m.Notifications.validate(v, path+".notifications")
+	m.Failures.validate(v, path+".failures", m.Notifications)
+	m.Population.validate(v, path+".population")
+
+	names := make(map[string]struct{})
+	for idx, a := range m.Alerts {
+		field := fmt.Sprintf("%s.alerts[%d]", path, idx)
+		if _, found := names[a.Name]; found && a.Name != "" {
+			v.addf(field+".name", "duplicate name %q", a.Name)
+		}
+		names[a.Name] = struct{}{}
+		a.validate(v, field)
+	}
+}
+
+func (n NotificationConfiguration) validate(v *validator, path string) {
+	if n.Enabled || n.Digest.Enabled {
+		v.required(path+".url", n.URL)
+	}
+	validateURL(v, path+".url", n.URL, RouteTypeShoutrrr)
+	validateTemplates(v, path, n.Title, n.Body)
+
+	names := map[string]struct{}{DefaultRoute: {}}
+	for idx, route := range n.Routes {
+		field := fmt.Sprintf("%s.routes[%d]", path, idx)
+		if _, found := names[route.Name]; found {
+			v.addf(field+".name", "duplicate name %q", route.Name)
+		}
+		names[route.Name] = struct{}{}
+		route.validate(v, field)
+	}
+
+	if !isValidDigestFormat(n.Digest.Format) {
+		v.addf(path+".digest.format", "invalid format %q", n.Digest.Format)
+	}
+	if n.QuietHours.IsSet() {
+		if _, err := notification.ParseQuietHours(n.QuietHours.Start, n.QuietHours.End, n.QuietHours.TimeZone); err != nil {
+			v.add(path+".quietHours", err)
+		}
+	}
+}
+
+func (r RouteConfiguration) validate(v *validator, path string) {
+	v.required(path+".name", r.Name)
+	if r.Enabled {
+		v.required(path+".url", r.URL)
+	}
+	if r.Type != "" && r.Type != RouteTypeShoutrrr && r.Type != RouteTypeWebhook {
+		v.addf(path+".type", "invalid type %q", r.Type)
+	} else {
+		validateURL(v, path+".url", r.URL, r.Type)
+	}
+	validateTemplates(v, path, r.Title, r.Body)
+}
+
+func (a AlertConfiguration) validate(v *validator, path string) {
+	v.required(path+".name", a.Name)
+	if len(a.Countries) == 0 {
+		v.addf(path+".countries", "required")
+	}
+	v.required(path+".url", a.URL)
+	validateURL(v, path+".url", a.URL, RouteTypeShoutrrr)
+	if !isValidSeverity(a.Severity) {
+		v.addf(path+".severity", "invalid severity %q", a.Severity)
+	}
+	if a.NewCases <= 0 && a.AverageIncrease <= 0 && a.Incidence <= 0 {
+		v.addf(path, "no conditions: set newCases, averageIncrease and/or incidence")
+	}
+}
+
+func (f FailureConfiguration) validate(v *validator, path string, notifications NotificationConfiguration) {
+	if f.Route != "" {
+		if route, found := notifications.GetRoute(f.Route); !found {
+			v.addf(path+".route", "unknown route %q", f.Route)
+		} else if route.URL == "" {
+			v.addf(path+".route", "route %q has no url", f.Route)
+		}
+	}
+	if f.StaleAfter < 0 {
+		v.addf(path+".staleAfter", "cannot be negative")
+	}
+}
+
+func (p PopulationConfiguration) validate(v *validator, path string) {
+	if p.MaxConcurrentJobs < 0 {
+		v.addf(path+".maxConcurrentJobs", "cannot be negative")
+	}
+}
+
+func validateTemplates(v *validator, path string, title, body string) {
+	if _, err := notification.ParseTemplates(title, ""); err != nil {
+		v.add(path+".title", err)
+	}
+	if _, err := notification.ParseTemplates("", body); err != nil {
+		v.add(path+".body", err)
+	}
+}
+
+// validateURL checks that a notification URL can be used for the route type. Blank URLs are not checked
+func validateURL(v *validator, field string, value string, routeType string) {
+	if value == "" {
+		return
+	}
+	if routeType == RouteTypeWebhook {
+		if u, err := url.Parse(value); err != nil {
+			v.add(field, err)
+		} else if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			v.addf(field, "invalid webhook url %q", value)
+		}
+		return
+	}
+	// creating a router only parses the URL. it doesn't contact the service
+	if _, err := shoutrrr.NewRouter(value); err != nil {
+		v.add(field, err)
+	}
+}
+
+func isValidDigestFormat(format string) bool {
+	if format == "" {
+		return true
+	}
+	for _, f := range notification.Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidSeverity(severity string) bool {
+	for _, s := range alert.Severities {
+		if s == severity {
+			return true
+		}
+	}
+	return false
+}
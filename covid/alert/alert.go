@@ -0,0 +1,319 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"github.com/clambin/covid19/covid/shoutrrr"
+	"github.com/clambin/covid19/models"
+	"github.com/clambin/go-common/set"
+	"golang.org/x/exp/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Severities lists the supported severities of a Rule
+var Severities = []string{"info", "warning", "critical"}
+
+// Rule raises an alert for a country, or for a region of countries, when all of its conditions are met.
+// Conditions left at zero are not evaluated.
+type Rule struct {
+	// Name of the rule
+	Name string
+	// Countries to evaluate. If Region is blank, each country is evaluated separately
+	Countries []string
+	// Region groups the countries: their figures are added up and evaluated as a whole
+	Region string
+	// Severity of the alert
+	Severity string
+	// NewCases raises an alert when the number of new cases on the latest day is higher than NewCases
+	NewCases int64
+	// AverageIncrease raises an alert when the 7-day average of new cases is up more than AverageIncrease percent
+	// compared to the week before
+	AverageIncrease float64
+	// Incidence raises an alert when the number of new cases over the last 7 days per 100.000 inhabitants is higher than Incidence
+	Incidence float64
+	// Sender sends the alert
+	Sender shoutrrr.Sender
+}
+
+// Alert is raised when a Rule's conditions are met
+type Alert struct {
+	// Rule that raised the alert
+	Rule string
+	// Target is the country or region that met the conditions
+	Target string
+	// Severity of the rule
+	Severity string
+	// Conditions describes each condition that was met
+	Conditions []string
+}
+
+// Title returns the title of the notification for the alert
+func (a Alert) Title() string {
+	return "[" + a.Severity + "] " + a.Rule + ": " + a.Target
+}
+
+// Body returns the body of the notification for the alert
+func (a Alert) Body() string {
+	return strings.Join(a.Conditions, "\n")
+}
+
+// DailyGetter returns the daily figures for a country
+type DailyGetter interface {
+	GetDailyForCountryName(context.Context, string) ([]models.DailyEntry, error)
+}
+
+// PopulationGetter returns the population figures of each country code by year
+type PopulationGetter interface {
+	ListByYear(context.Context) (models.PopulationHistory, error)
+}
+
+// StateStore records the report date of the last alert sent for each target of a rule. The rule's records are stored
+// under the route returned by StateRoute.
+type StateStore interface {
+	GetLastNotified(ctx context.Context, route string) (map[string]models.CountryEntry, error)
+	SetLastNotified(ctx context.Context, route string, entry models.CountryEntry) error
+}
+
+// StateRoute returns the route under which the alerts of a rule are recorded in the StateStore
+func StateRoute(rule string) string {
+	return "alert:" + rule
+}
+
+// Evaluator evaluates a set of Rules against the latest figures in the database
+type Evaluator struct {
+	Rules      []Rule
+	Store      DailyGetter
+	Population PopulationGetter
+	// State records the alerts that were sent, so a report date is alerted at most once. If nil, the alerts of a
+	// report date are sent each time it is evaluated
+	State StateStore
+}
+
+// raisedAlert is an Alert, with the report date of the figures that raised it
+type raisedAlert struct {
+	Alert
+	date time.Time
+	// ongoing is set if the rule's conditions were also met on the previous report date
+	ongoing bool
+}
+
+// Evaluate returns the alerts raised by the rules for the countries that received new data
+func (e Evaluator) Evaluate(ctx context.Context, updates []models.CountryEntry) ([]Alert, error) {
+	raised, err := e.evaluate(ctx, updates)
+	var alerts []Alert
+	for _, r := range raised {
+		alerts = append(alerts, r.Alert)
+	}
+	return alerts, err
+}
+
+func (e Evaluator) evaluate(ctx context.Context, updates []models.CountryEntry) ([]raisedAlert, error) {
+	updated := set.Create[string]()
+	for _, update := range updates {
+		updated.Add(update.Name)
+	}
+
+	population, err := e.getPopulation(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("population: %w", err)
+	}
+
+	var raised []raisedAlert
+	for _, rule := range e.Rules {
+		for _, target := range rule.targets(updated) {
+			series, codes, err := e.getSeries(ctx, target.countries)
+			if err != nil {
+				return raised, fmt.Errorf("%s: %w", target.name, err)
+			}
+			if len(series) == 0 {
+				continue
+			}
+			// the incidence is calculated against the population of the latest report year
+			pop := totalPopulation(codes, population, series[len(series)-1].Timestamp)
+			if conditions := rule.evaluate(series, pop); len(conditions) > 0 {
+				raised = append(raised, raisedAlert{
+					Alert: Alert{
+						Rule:       rule.Name,
+						Target:     target.name,
+						Severity:   rule.Severity,
+						Conditions: conditions,
+					},
+					date:    series[len(series)-1].Timestamp,
+					ongoing: len(rule.evaluate(series[:len(series)-1], pop)) > 0,
+				})
+			}
+		}
+	}
+	return raised, nil
+}
+
+// Notify evaluates the rules and sends the raised alerts to the rule's Sender. An alert is only sent when the rule
+// starts firing for a target: if its conditions were also met on the previous report date, no alert is sent. If State
+// is set, each report date is alerted at most once, even if the loader processes it again.
+func (e Evaluator) Notify(ctx context.Context, updates []models.CountryEntry) error {
+	raised, err := e.evaluate(ctx, updates)
+	if err != nil {
+		return fmt.Errorf("evaluate: %w", err)
+	}
+
+	senders := make(map[string]shoutrrr.Sender)
+	for _, rule := range e.Rules {
+		senders[rule.Name] = rule.Sender
+	}
+
+	alerted := make(map[string]map[string]models.CountryEntry)
+	for _, r := range raised {
+		if r.ongoing {
+			slog.Debug("alert still raised", "rule", r.Rule, "target", r.Target)
+			continue
+		}
+		if e.State != nil {
+			if _, ok := alerted[r.Rule]; !ok {
+				if alerted[r.Rule], err = e.State.GetLastNotified(ctx, StateRoute(r.Rule)); err != nil {
+					return fmt.Errorf("get last alert: %w", err)
+				}
+			}
+			if last, ok := alerted[r.Rule][r.Target]; ok && !r.date.After(last.Timestamp) {
+				slog.Debug("alert already sent", "rule", r.Rule, "target", r.Target, "date", r.date)
+				continue
+			}
+			// record the alert before sending it, so a failed alert is not retried, as with notifications
+			if err = e.State.SetLastNotified(ctx, StateRoute(r.Rule), models.CountryEntry{Name: r.Target, Timestamp: r.date}); err != nil {
+				return fmt.Errorf("set last alert: %w", err)
+			}
+		}
+		slog.Info("alert raised", "rule", r.Rule, "target", r.Target, "severity", r.Severity)
+		if err = senders[r.Rule].Send(r.Title(), r.Body()); err != nil {
+			slog.Error("failed to send alert", "err", err, "rule", r.Rule, "target", r.Target)
+		}
+	}
+	return nil
+}
+
+func (e Evaluator) getPopulation(ctx context.Context) (models.PopulationHistory, error) {
+	if e.Population == nil {
+		return models.PopulationHistory{}, nil
+	}
+	return e.Population.ListByYear(ctx)
+}
+
+// getSeries returns the daily figures for a set of countries, added up per day, and the codes of those countries
+func (e Evaluator) getSeries(ctx context.Context, countries []string) ([]models.DailyEntry, []string, error) {
+	days := make(map[time.Time]models.DailyEntry)
+	codes := make([]string, 0, len(countries))
+	for _, country := range countries {
+		entries, err := e.Store.GetDailyForCountryName(ctx, country)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		codes = append(codes, entries[0].Code)
+		for _, entry := range entries {
+			total := days[entry.Timestamp]
+			total.Timestamp = entry.Timestamp
+			total.NewConfirmed += entry.NewConfirmed
+			total.NewDeaths += entry.NewDeaths
+			total.ConfirmedAverage += entry.ConfirmedAverage
+			total.DeathsAverage += entry.DeathsAverage
+			days[entry.Timestamp] = total
+		}
+	}
+
+	series := make([]models.DailyEntry, 0, len(days))
+	for _, entry := range days {
+		series = append(series, entry)
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].Timestamp.Before(series[j].Timestamp) })
+	return series, codes, nil
+}
+
+// totalPopulation returns the population of a set of countries at the specified date. If the population of any country
+// is unknown, totalPopulation returns zero, so that no incidence is calculated.
+func totalPopulation(codes []string, population models.PopulationHistory, date time.Time) int64 {
+	var total int64
+	for _, code := range codes {
+		pop, ok := population.Get(code, date)
+		if !ok {
+			return 0
+		}
+		total += pop
+	}
+	return total
+}
+
+type target struct {
+	name      string
+	countries []string
+}
+
+// targets returns the countries, or region, to evaluate for the rule. Countries that didn't receive new data are skipped.
+func (r Rule) targets(updated set.Set[string]) []target {
+	if r.Region != "" {
+		for _, country := range r.Countries {
+			if updated.Contains(country) {
+				return []target{{name: r.Region, countries: r.Countries}}
+			}
+		}
+		return nil
+	}
+	var targets []target
+	for _, country := range r.Countries {
+		if updated.Contains(country) {
+			targets = append(targets, target{name: country, countries: []string{country}})
+		}
+	}
+	return targets
+}
+
+// evaluate returns a description of each condition that was met. If any condition isn't met, evaluate returns nil.
+func (r Rule) evaluate(series []models.DailyEntry, population int64) []string {
+	if len(series) == 0 {
+		return nil
+	}
+	latest := series[len(series)-1]
+
+	var conditions []string
+	if r.NewCases > 0 {
+		if latest.NewConfirmed <= r.NewCases {
+			return nil
+		}
+		conditions = append(conditions, fmt.Sprintf("new cases: %d (threshold: %d)", latest.NewConfirmed, r.NewCases))
+	}
+	if r.AverageIncrease > 0 {
+		increase, ok := weekOverWeek(series)
+		if !ok || increase <= r.AverageIncrease {
+			return nil
+		}
+		conditions = append(conditions, fmt.Sprintf("7-day average up %.1f%% week-over-week (threshold: %.1f%%)", increase, r.AverageIncrease))
+	}
+	if r.Incidence > 0 {
+		if population <= 0 {
+			return nil
+		}
+		incidence := 7 * latest.ConfirmedAverage * 100000 / float64(population)
+		if incidence <= r.Incidence {
+			return nil
+		}
+		conditions = append(conditions, fmt.Sprintf("7-day incidence: %.1f per 100k (threshold: %.1f)", incidence, r.Incidence))
+	}
+	return conditions
+}
+
+// weekOverWeek returns the percentage increase of the 7-day average of new cases compared to seven days earlier
+func weekOverWeek(series []models.DailyEntry) (float64, bool) {
+	latest := series[len(series)-1]
+	weekAgo := latest.Timestamp.AddDate(0, 0, -7)
+	for _, entry := range series {
+		if entry.Timestamp.Equal(weekAgo) {
+			if entry.ConfirmedAverage <= 0 {
+				return 0, false
+			}
+			return 100 * (latest.ConfirmedAverage/entry.ConfirmedAverage - 1), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,190 @@
+package alert_test
+
+import (
+	"context"
+	"github.com/clambin/covid19/covid/alert"
+	"github.com/clambin/covid19/covid/shoutrrr/mocks"
+	"github.com/clambin/covid19/internal/testtools/db/covid"
+	"github.com/clambin/covid19/internal/testtools/db/notification"
+	"github.com/clambin/covid19/internal/testtools/db/population"
+	"github.com/clambin/covid19/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// makeRecords creates 15 days of figures for a country: 100 new cases per day for the first week, 200 per day for the second
+func makeRecords(name, code string) []models.CountryEntry {
+	var records []models.CountryEntry
+	var confirmed int64
+	for day := 0; day < 15; day++ {
+		if day > 0 && day <= 7 {
+			confirmed += 100
+		} else if day > 7 {
+			confirmed += 200
+		}
+		records = append(records, models.CountryEntry{
+			Timestamp: time.Date(2023, time.March, 2+day, 12, 0, 0, 0, time.UTC),
+			Code:      code,
+			Name:      name,
+			Confirmed: confirmed,
+		})
+	}
+	return records
+}
+
+func TestEvaluator_Evaluate(t *testing.T) {
+	store := covid.FakeStore{Records: append(makeRecords("Belgium", "BE"), makeRecords("Netherlands", "NL")...)}
+	pop := population.FakeStore{Content: models.PopulationHistory{"BE": {2023: 1000000}, "NL": {2023: 1000000}}}
+	updates := []models.CountryEntry{store.Records[14], store.Records[29]}
+
+	tests := []struct {
+		name string
+		rule alert.Rule
+		want []alert.Alert
+	}{
+		{
+			name: "new cases",
+			rule: alert.Rule{Name: "cases", Countries: []string{"Belgium"}, Severity: "info", NewCases: 150},
+			want: []alert.Alert{{Rule: "cases", Target: "Belgium", Severity: "info", Conditions: []string{"new cases: 200 (threshold: 150)"}}},
+		},
+		{
+			name: "new cases below threshold",
+			rule: alert.Rule{Name: "cases", Countries: []string{"Belgium"}, Severity: "info", NewCases: 200},
+		},
+		{
+			name: "average increase",
+			rule: alert.Rule{Name: "trend", Countries: []string{"Belgium", "Netherlands"}, Severity: "warning", AverageIncrease: 50},
+			want: []alert.Alert{
+				{Rule: "trend", Target: "Belgium", Severity: "warning", Conditions: []string{"7-day average up 100.0% week-over-week (threshold: 50.0%)"}},
+				{Rule: "trend", Target: "Netherlands", Severity: "warning", Conditions: []string{"7-day average up 100.0% week-over-week (threshold: 50.0%)"}},
+			},
+		},
+		{
+			name: "incidence",
+			rule: alert.Rule{Name: "incidence", Countries: []string{"Belgium"}, Severity: "critical", Incidence: 100},
+			want: []alert.Alert{{Rule: "incidence", Target: "Belgium", Severity: "critical", Conditions: []string{"7-day incidence: 140.0 per 100k (threshold: 100.0)"}}},
+		},
+		{
+			name: "all conditions must be met",
+			rule: alert.Rule{Name: "combined", Countries: []string{"Belgium"}, Severity: "info", AverageIncrease: 50, Incidence: 150},
+		},
+		{
+			name: "region",
+			rule: alert.Rule{Name: "region", Countries: []string{"Belgium", "Netherlands"}, Region: "Benelux", Severity: "info", NewCases: 300, Incidence: 100},
+			want: []alert.Alert{{Rule: "region", Target: "Benelux", Severity: "info", Conditions: []string{
+				"new cases: 400 (threshold: 300)",
+				"7-day incidence: 140.0 per 100k (threshold: 100.0)",
+			}}},
+		},
+		{
+			name: "country without update",
+			rule: alert.Rule{Name: "cases", Countries: []string{"France"}, Severity: "info", NewCases: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := alert.Evaluator{Rules: []alert.Rule{tt.rule}, Store: &store, Population: &pop}
+			alerts, err := e.Evaluate(context.Background(), updates)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, alerts)
+		})
+	}
+}
+
+func TestEvaluator_Evaluate_NoPopulation(t *testing.T) {
+	store := covid.FakeStore{Records: makeRecords("Belgium", "BE")}
+	e := alert.Evaluator{
+		Rules: []alert.Rule{{Name: "incidence", Countries: []string{"Belgium"}, Severity: "info", Incidence: 1}},
+		Store: &store,
+	}
+	alerts, err := e.Evaluate(context.Background(), store.Records[14:])
+	require.NoError(t, err)
+	assert.Empty(t, alerts)
+}
+
+func TestEvaluator_Evaluate_PopulationYear(t *testing.T) {
+	store := covid.FakeStore{Records: makeRecords("Belgium", "BE")}
+	// the figures are for 2023: the 2024 population figure is not used
+	pop := population.FakeStore{Content: models.PopulationHistory{"BE": {2022: 1000000, 2024: 2000000}}}
+	e := alert.Evaluator{
+		Rules:      []alert.Rule{{Name: "incidence", Countries: []string{"Belgium"}, Severity: "critical", Incidence: 100}},
+		Store:      &store,
+		Population: &pop,
+	}
+	alerts, err := e.Evaluate(context.Background(), store.Records[14:])
+	require.NoError(t, err)
+	assert.Equal(t, []alert.Alert{{Rule: "incidence", Target: "Belgium", Severity: "critical", Conditions: []string{"7-day incidence: 140.0 per 100k (threshold: 100.0)"}}}, alerts)
+}
+
+func TestEvaluator_Evaluate_Failure(t *testing.T) {
+	store := covid.FakeStore{Records: makeRecords("Belgium", "BE"), Fail: true}
+	e := alert.Evaluator{
+		Rules: []alert.Rule{{Name: "cases", Countries: []string{"Belgium"}, Severity: "info", NewCases: 1}},
+		Store: &store,
+	}
+	_, err := e.Evaluate(context.Background(), store.Records[14:])
+	assert.Error(t, err)
+
+	e.Store = &covid.FakeStore{Records: makeRecords("Belgium", "BE")}
+	e.Population = &population.FakeStore{Fail: true}
+	_, err = e.Evaluate(context.Background(), store.Records[14:])
+	assert.Error(t, err)
+}
+
+func TestEvaluator_Notify(t *testing.T) {
+	records := makeRecords("Belgium", "BE")
+	s := mocks.NewSender(t)
+	state := notification.FakeStore{}
+	e := alert.Evaluator{
+		Rules: []alert.Rule{
+			{Name: "cases", Countries: []string{"Belgium"}, Severity: "warning", NewCases: 150, Sender: s},
+			{Name: "quiet", Countries: []string{"Belgium"}, Severity: "info", NewCases: 1000, Sender: s},
+		},
+		State: &state,
+	}
+
+	// the rule starts firing on the 8th day
+	e.Store = &covid.FakeStore{Records: records[:9]}
+	s.On("Send", "[warning] cases: Belgium", "new cases: 200 (threshold: 150)").Return(nil).Once()
+	err := e.Notify(context.Background(), records[8:9])
+	require.NoError(t, err)
+	assert.Equal(t, records[8].GetReportDate(), state.Content[alert.StateRoute("cases")]["Belgium"].Timestamp)
+
+	// the same report date isn't alerted again
+	err = e.Notify(context.Background(), records[8:9])
+	require.NoError(t, err)
+
+	// the rule keeps firing on the next day: no new alert
+	e.Store = &covid.FakeStore{Records: records[:10]}
+	err = e.Notify(context.Background(), records[9:10])
+	require.NoError(t, err)
+}
+
+func TestEvaluator_Notify_NoState(t *testing.T) {
+	records := makeRecords("Belgium", "BE")
+	s := mocks.NewSender(t)
+	e := alert.Evaluator{
+		Rules: []alert.Rule{{Name: "cases", Countries: []string{"Belgium"}, Severity: "warning", NewCases: 150, Sender: s}},
+		Store: &covid.FakeStore{Records: records[:9]},
+	}
+
+	s.On("Send", "[warning] cases: Belgium", "new cases: 200 (threshold: 150)").Return(nil).Twice()
+	for i := 0; i < 2; i++ {
+		err := e.Notify(context.Background(), records[8:9])
+		require.NoError(t, err)
+	}
+}
+
+func TestEvaluator_Notify_StateFailure(t *testing.T) {
+	records := makeRecords("Belgium", "BE")
+	e := alert.Evaluator{
+		Rules: []alert.Rule{{Name: "cases", Countries: []string{"Belgium"}, Severity: "warning", NewCases: 150, Sender: mocks.NewSender(t)}},
+		Store: &covid.FakeStore{Records: records[:9]},
+		State: &notification.FakeStore{Fail: true},
+	}
+	err := e.Notify(context.Background(), records[8:9])
+	assert.Error(t, err)
+}
@@ -0,0 +1,68 @@
+package covid
+
+import (
+	"context"
+	"fmt"
+	"github.com/clambin/covid19/covid/notification"
+	"github.com/clambin/covid19/covid/shoutrrr"
+	"github.com/clambin/covid19/models"
+	"golang.org/x/exp/slog"
+)
+
+// Digester sends one summary of the latest figures of a set of countries per update
+type Digester struct {
+	shoutrrr.Sender
+	Countries []string
+	// Format of the digest: notification.FormatMarkdown (default) or notification.FormatText
+	Format string
+	Store  DigestGetter
+}
+
+// DigestGetter returns the daily figures for a country and for the whole world
+type DigestGetter interface {
+	DailyGetter
+	GetTotalsPerDay(context.Context) ([]models.DailyEntry, error)
+}
+
+// Notify sends the digest. If there are no updates, no digest is sent
+func (d Digester) Notify(ctx context.Context, updates []models.CountryEntry) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	digest, err := d.makeDigest(ctx)
+	if err != nil {
+		return fmt.Errorf("digest: %w", err)
+	}
+	body, err := digest.Render(d.Format)
+	if err != nil {
+		return fmt.Errorf("digest: %w", err)
+	}
+
+	slog.Info("sending digest", "countries", len(digest.Countries))
+	if err = d.Sender.Send(digest.Title(), body); err != nil {
+		err = fmt.Errorf("send: %w", err)
+	}
+	return err
+}
+
+func (d Digester) makeDigest(ctx context.Context) (notification.Digest, error) {
+	world, err := d.Store.GetTotalsPerDay(ctx)
+	if err != nil {
+		return notification.Digest{}, fmt.Errorf("world: %w", err)
+	}
+
+	digest := notification.Digest{World: notification.NewDigestEntry("World", world)}
+	if len(world) > 0 {
+		digest.Date = world[len(world)-1].Timestamp
+	}
+
+	for _, country := range d.Countries {
+		entries, err := d.Store.GetDailyForCountryName(ctx, country)
+		if err != nil {
+			return notification.Digest{}, fmt.Errorf("%s: %w", country, err)
+		}
+		digest.Countries = append(digest.Countries, notification.NewDigestEntry(country, entries))
+	}
+	return digest, nil
+}
@@ -0,0 +1,46 @@
+package covid_test
+
+import (
+	"context"
+	"github.com/clambin/covid19/covid"
+	"github.com/clambin/covid19/covid/notification"
+	"github.com/clambin/covid19/covid/shoutrrr/mocks"
+	covid2 "github.com/clambin/covid19/internal/testtools/db/covid"
+	"github.com/clambin/covid19/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDigester_Notify(t *testing.T) {
+	fdb := covid2.FakeStore{Records: []models.CountryEntry{
+		{Timestamp: time.Date(2023, time.March, 21, 12, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 100, Deaths: 10},
+		{Timestamp: time.Date(2023, time.March, 22, 12, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 150, Deaths: 12},
+		{Timestamp: time.Date(2023, time.March, 21, 12, 0, 0, 0, time.UTC), Code: "US", Name: "US", Confirmed: 1000, Deaths: 100},
+		{Timestamp: time.Date(2023, time.March, 22, 12, 0, 0, 0, time.UTC), Code: "US", Name: "US", Confirmed: 1200, Deaths: 120},
+	}}
+	s := mocks.NewSender(t)
+	d := covid.Digester{
+		Sender:    s,
+		Countries: []string{"Belgium", "US"},
+		Format:    notification.FormatText,
+		Store:     &fdb,
+	}
+
+	// no updates: no digest
+	err := d.Notify(context.Background(), nil)
+	require.NoError(t, err)
+
+	s.On("Send", "COVID-19 digest for 2023-03-21", `Country  New cases  Deaths  Trend
+Belgium  50         2       ?
+US       200        20      ?
+World    250        22      ?
+`).Return(nil).Once()
+	err = d.Notify(context.Background(), fdb.Records[1:2])
+	require.NoError(t, err)
+
+	fdb.Fail = true
+	err = d.Notify(context.Background(), fdb.Records[1:2])
+	assert.Error(t, err)
+}
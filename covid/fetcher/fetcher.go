@@ -40,11 +40,12 @@ func (client *Client) Fetch(ctx context.Context) ([]models.CountryEntry, error)
 	var records []models.CountryEntry
 	for _, entry := range stats.Data.Covid19Stats {
 		records = append(records, models.CountryEntry{
-			Timestamp: entry.LastUpdate.UTC(),
-			Name:      entry.Country,
-			Confirmed: entry.Confirmed,
-			Recovered: entry.Recovered,
-			Deaths:    entry.Deaths,
+			Timestamp:  entry.LastUpdate.UTC(),
+			ReportDate: models.ReportDate(entry.LastUpdate),
+			Name:       entry.Country,
+			Confirmed:  entry.Confirmed,
+			Recovered:  entry.Recovered,
+			Deaths:     entry.Deaths,
 		})
 	}
 	return sumByCountry(records), nil
@@ -57,9 +58,10 @@ func sumByCountry(entries []models.CountryEntry) (sum []models.CountryEntry) {
 		sumEntry, found := summed[entry.Name]
 		if !found {
 			sumEntry = models.CountryEntry{
-				Timestamp: entry.Timestamp,
-				Code:      entry.Code,
-				Name:      entry.Name,
+				Timestamp:  entry.Timestamp,
+				ReportDate: entry.ReportDate,
+				Code:       entry.Code,
+				Name:       entry.Name,
 			}
 		}
 		sumEntry.Confirmed += entry.Confirmed
@@ -27,9 +27,9 @@ func TestClient_Fetch(t *testing.T) {
 			responseErr:  nil,
 			wantErr:      assert.NoError,
 			want: []models.CountryEntry{
-				{Timestamp: time.Date(2020, time.December, 3, 5, 28, 22, 0, time.UTC), Code: "", Name: "Belgium", Confirmed: 3, Recovered: 1, Deaths: 2},
-				{Timestamp: time.Date(2020, time.December, 3, 5, 28, 22, 0, time.UTC), Code: "", Name: "US", Confirmed: 6, Recovered: 4, Deaths: 5},
-				{Timestamp: time.Date(2020, time.December, 3, 5, 28, 22, 0, time.UTC), Code: "", Name: "invalid_country", Confirmed: 1, Recovered: 1, Deaths: 1},
+				{Timestamp: time.Date(2020, time.December, 3, 5, 28, 22, 0, time.UTC), ReportDate: time.Date(2020, time.December, 2, 0, 0, 0, 0, time.UTC), Code: "", Name: "Belgium", Confirmed: 3, Recovered: 1, Deaths: 2},
+				{Timestamp: time.Date(2020, time.December, 3, 5, 28, 22, 0, time.UTC), ReportDate: time.Date(2020, time.December, 2, 0, 0, 0, 0, time.UTC), Code: "", Name: "US", Confirmed: 6, Recovered: 4, Deaths: 5},
+				{Timestamp: time.Date(2020, time.December, 3, 5, 28, 22, 0, time.UTC), ReportDate: time.Date(2020, time.December, 2, 0, 0, 0, 0, time.UTC), Code: "", Name: "invalid_country", Confirmed: 1, Recovered: 1, Deaths: 1},
 			},
 		},
 		{
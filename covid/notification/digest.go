@@ -0,0 +1,145 @@
+package notification
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/clambin/covid19/models"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Digest formats
+const (
+	FormatMarkdown = "markdown"
+	FormatText     = "text"
+)
+
+// Formats lists the supported digest formats
+var Formats = []string{FormatMarkdown, FormatText}
+
+// Trend of the 7-day average of new cases
+type Trend int
+
+const (
+	// TrendUnknown means there are no figures for the week before
+	TrendUnknown Trend = iota
+	// TrendFlat means the 7-day average changed less than TrendMargin
+	TrendFlat
+	// TrendUp means the 7-day average increased more than TrendMargin
+	TrendUp
+	// TrendDown means the 7-day average decreased more than TrendMargin
+	TrendDown
+)
+
+// TrendMargin is the percentage by which the 7-day average must change compared to the week before to be reported as up or down
+const TrendMargin = 5.0
+
+func (t Trend) String() string {
+	switch t {
+	case TrendFlat:
+		return "→"
+	case TrendUp:
+		return "↑"
+	case TrendDown:
+		return "↓"
+	default:
+		return "?"
+	}
+}
+
+// DigestEntry contains the figures of one country, or the world, on the latest day
+type DigestEntry struct {
+	Name         string
+	NewConfirmed int64
+	NewDeaths    int64
+	Trend        Trend
+}
+
+// NewDigestEntry creates a DigestEntry from the daily figures of a country. entries must be sorted by time
+func NewDigestEntry(name string, entries []models.DailyEntry) DigestEntry {
+	entry := DigestEntry{Name: name}
+	if len(entries) == 0 {
+		return entry
+	}
+	latest := entries[len(entries)-1]
+	entry.NewConfirmed = latest.NewConfirmed
+	entry.NewDeaths = latest.NewDeaths
+
+	weekAgo := latest.Timestamp.AddDate(0, 0, -7)
+	for _, e := range entries {
+		if e.Timestamp.Equal(weekAgo) {
+			entry.Trend = trend(e.ConfirmedAverage, latest.ConfirmedAverage)
+			break
+		}
+	}
+	return entry
+}
+
+func trend(previous, current float64) Trend {
+	if previous <= 0 {
+		if current > 0 {
+			return TrendUp
+		}
+		return TrendFlat
+	}
+	change := 100 * (current/previous - 1)
+	switch {
+	case change > TrendMargin:
+		return TrendUp
+	case change < -TrendMargin:
+		return TrendDown
+	default:
+		return TrendFlat
+	}
+}
+
+// Digest summarizes the latest figures of a set of countries and the world
+type Digest struct {
+	// Date of the latest figures
+	Date      time.Time
+	Countries []DigestEntry
+	World     DigestEntry
+}
+
+// Title returns the title of the digest
+func (d Digest) Title() string {
+	return "COVID-19 digest for " + d.Date.Format("2006-01-02")
+}
+
+// Render returns the body of the digest in the requested format
+func (d Digest) Render(format string) (string, error) {
+	switch format {
+	case FormatMarkdown, "":
+		return d.Markdown(), nil
+	case FormatText:
+		return d.Text(), nil
+	default:
+		return "", fmt.Errorf("invalid format: %s", format)
+	}
+}
+
+// Markdown returns the digest as a markdown table
+func (d Digest) Markdown() string {
+	var b strings.Builder
+	b.WriteString("| Country | New cases | Deaths | Trend |\n")
+	b.WriteString("|---|---:|---:|:---:|\n")
+	for _, entry := range d.Countries {
+		_, _ = fmt.Fprintf(&b, "| %s | %d | %d | %s |\n", entry.Name, entry.NewConfirmed, entry.NewDeaths, entry.Trend)
+	}
+	_, _ = fmt.Fprintf(&b, "| **%s** | **%d** | **%d** | %s |\n", d.World.Name, d.World.NewConfirmed, d.World.NewDeaths, d.World.Trend)
+	return b.String()
+}
+
+// Text returns the digest as a plain text table
+func (d Digest) Text() string {
+	var b bytes.Buffer
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "Country\tNew cases\tDeaths\tTrend")
+	for _, entry := range d.Countries {
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", entry.Name, entry.NewConfirmed, entry.NewDeaths, entry.Trend)
+	}
+	_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", d.World.Name, d.World.NewConfirmed, d.World.NewDeaths, d.World.Trend)
+	_ = w.Flush()
+	return b.String()
+}
@@ -0,0 +1,93 @@
+package notification_test
+
+import (
+	"github.com/clambin/covid19/covid/notification"
+	"github.com/clambin/covid19/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestNewDigestEntry(t *testing.T) {
+	day := time.Date(2023, time.March, 21, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		entries []models.DailyEntry
+		want    notification.DigestEntry
+	}{
+		{
+			name: "empty",
+			want: notification.DigestEntry{Name: "Belgium"},
+		},
+		{
+			name:    "no history",
+			entries: []models.DailyEntry{{Timestamp: day, NewConfirmed: 10, NewDeaths: 1, ConfirmedAverage: 5}},
+			want:    notification.DigestEntry{Name: "Belgium", NewConfirmed: 10, NewDeaths: 1, Trend: notification.TrendUnknown},
+		},
+		{
+			name: "up",
+			entries: []models.DailyEntry{
+				{Timestamp: day.AddDate(0, 0, -7), ConfirmedAverage: 100},
+				{Timestamp: day, NewConfirmed: 10, NewDeaths: 1, ConfirmedAverage: 110},
+			},
+			want: notification.DigestEntry{Name: "Belgium", NewConfirmed: 10, NewDeaths: 1, Trend: notification.TrendUp},
+		},
+		{
+			name: "flat",
+			entries: []models.DailyEntry{
+				{Timestamp: day.AddDate(0, 0, -7), ConfirmedAverage: 100},
+				{Timestamp: day, NewConfirmed: 10, NewDeaths: 1, ConfirmedAverage: 104},
+			},
+			want: notification.DigestEntry{Name: "Belgium", NewConfirmed: 10, NewDeaths: 1, Trend: notification.TrendFlat},
+		},
+		{
+			name: "down",
+			entries: []models.DailyEntry{
+				{Timestamp: day.AddDate(0, 0, -7), ConfirmedAverage: 100},
+				{Timestamp: day, NewConfirmed: 10, NewDeaths: 1, ConfirmedAverage: 90},
+			},
+			want: notification.DigestEntry{Name: "Belgium", NewConfirmed: 10, NewDeaths: 1, Trend: notification.TrendDown},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, notification.NewDigestEntry("Belgium", tt.entries))
+		})
+	}
+}
+
+func TestDigest_Render(t *testing.T) {
+	d := notification.Digest{
+		Date: time.Date(2023, time.March, 21, 0, 0, 0, 0, time.UTC),
+		Countries: []notification.DigestEntry{
+			{Name: "Belgium", NewConfirmed: 1200, NewDeaths: 5, Trend: notification.TrendUp},
+			{Name: "US", NewConfirmed: 35000, NewDeaths: 250, Trend: notification.TrendDown},
+		},
+		World: notification.DigestEntry{Name: "World", NewConfirmed: 150000, NewDeaths: 1500, Trend: notification.TrendFlat},
+	}
+
+	assert.Equal(t, "COVID-19 digest for 2023-03-21", d.Title())
+
+	body, err := d.Render(notification.FormatMarkdown)
+	require.NoError(t, err)
+	assert.Equal(t, `| Country | New cases | Deaths | Trend |
+|---|---:|---:|:---:|
+| Belgium | 1200 | 5 | ↑ |
+| US | 35000 | 250 | ↓ |
+| **World** | **150000** | **1500** | → |
+`, body)
+
+	body, err = d.Render(notification.FormatText)
+	require.NoError(t, err)
+	assert.Equal(t, `Country  New cases  Deaths  Trend
+Belgium  1200       5       ↑
+US       35000      250     ↓
+World    150000     1500    →
+`, body)
+
+	_, err = d.Render("html")
+	assert.Error(t, err)
+}
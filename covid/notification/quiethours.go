@@ -0,0 +1,58 @@
+package notification
+
+import (
+	"fmt"
+	"time"
+)
+
+// QuietHours is a daily period during which no notifications are sent. If End is before Start, the period spans midnight.
+type QuietHours struct {
+	// Start of the quiet hours, as the offset since midnight
+	Start time.Duration
+	// End of the quiet hours, as the offset since midnight
+	End time.Duration
+	// Location is the time zone of Start and End
+	Location *time.Location
+}
+
+// ParseQuietHours creates QuietHours from a start and end time ("22:00", "07:30") in the provided time zone.
+// If timezone is blank, UTC is used.
+func ParseQuietHours(start, end, timezone string) (QuietHours, error) {
+	var q QuietHours
+	var err error
+	if q.Start, err = parseTimeOfDay(start); err != nil {
+		return QuietHours{}, fmt.Errorf("start: %w", err)
+	}
+	if q.End, err = parseTimeOfDay(end); err != nil {
+		return QuietHours{}, fmt.Errorf("end: %w", err)
+	}
+	if q.Location, err = time.LoadLocation(timezone); err != nil {
+		return QuietHours{}, fmt.Errorf("timezone: %w", err)
+	}
+	return q, nil
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains returns true if t falls within the quiet hours
+func (q QuietHours) Contains(t time.Time) bool {
+	if q.Start == q.End {
+		return false
+	}
+	location := q.Location
+	if location == nil {
+		location = time.UTC
+	}
+	t = t.In(location)
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if q.Start < q.End {
+		return offset >= q.Start && offset < q.End
+	}
+	return offset >= q.Start || offset < q.End
+}
@@ -0,0 +1,58 @@
+package notification_test
+
+import (
+	"github.com/clambin/covid19/covid/notification"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	q, err := notification.ParseQuietHours("22:00", "07:30", "Europe/Brussels")
+	require.NoError(t, err)
+	assert.Equal(t, 22*time.Hour, q.Start)
+	assert.Equal(t, 7*time.Hour+30*time.Minute, q.End)
+	assert.Equal(t, "Europe/Brussels", q.Location.String())
+
+	q, err = notification.ParseQuietHours("22:00", "07:30", "")
+	require.NoError(t, err)
+	assert.Equal(t, time.UTC, q.Location)
+
+	_, err = notification.ParseQuietHours("22", "07:30", "")
+	assert.Error(t, err)
+	_, err = notification.ParseQuietHours("22:00", "", "")
+	assert.Error(t, err)
+	_, err = notification.ParseQuietHours("22:00", "07:30", "Europe/Nowhere")
+	assert.Error(t, err)
+}
+
+func TestQuietHours_Contains(t *testing.T) {
+	overnight, err := notification.ParseQuietHours("22:00", "07:00", "Europe/Brussels")
+	require.NoError(t, err)
+	daytime, err := notification.ParseQuietHours("09:00", "17:00", "")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		quietHours notification.QuietHours
+		time       time.Time
+		want       bool
+	}{
+		{name: "overnight - evening", quietHours: overnight, time: time.Date(2023, time.March, 21, 21, 30, 0, 0, time.UTC), want: true},
+		{name: "overnight - morning", quietHours: overnight, time: time.Date(2023, time.March, 22, 5, 59, 0, 0, time.UTC), want: true},
+		{name: "overnight - end", quietHours: overnight, time: time.Date(2023, time.March, 22, 6, 0, 0, 0, time.UTC), want: false},
+		{name: "overnight - summer time", quietHours: overnight, time: time.Date(2023, time.June, 22, 5, 30, 0, 0, time.UTC), want: false},
+		{name: "overnight - day", quietHours: overnight, time: time.Date(2023, time.March, 22, 12, 0, 0, 0, time.UTC), want: false},
+		{name: "daytime - start", quietHours: daytime, time: time.Date(2023, time.March, 22, 9, 0, 0, 0, time.UTC), want: true},
+		{name: "daytime - night", quietHours: daytime, time: time.Date(2023, time.March, 22, 20, 0, 0, 0, time.UTC), want: false},
+		{name: "empty", quietHours: notification.QuietHours{}, time: time.Date(2023, time.March, 22, 20, 0, 0, 0, time.UTC), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.quietHours.Contains(tt.time))
+		})
+	}
+}
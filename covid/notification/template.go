@@ -0,0 +1,131 @@
+package notification
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/clambin/covid19/models"
+	"text/template"
+)
+
+const (
+	// DefaultTitle is the title template used when no title template is configured
+	DefaultTitle = "New data for {{.Name}}"
+	// DefaultBody is the body template used when no body template is configured
+	DefaultBody = "Confirmed: {{.NewConfirmed}}, deaths: {{.NewDeaths}}"
+)
+
+// Data contains the information available to the title and body templates
+type Data struct {
+	// Name of the country
+	Name string
+	// Code is the country's two-letter code
+	Code string
+	// Previous is the last entry for the country before the update
+	Previous models.CountryEntry
+	// Current is the new entry for the country
+	Current models.CountryEntry
+	// NewConfirmed is the number of new confirmed cases since the previous entry
+	NewConfirmed int64
+	// NewRecovered is the number of new recovered cases since the previous entry
+	NewRecovered int64
+	// NewDeaths is the number of new deaths since the previous entry
+	NewDeaths int64
+	// Population of the country in the report year. Zero if unknown
+	Population int64
+	// ConfirmedPer100K is the total number of confirmed cases per 100.000 inhabitants
+	ConfirmedPer100K float64
+	// DeathsPer100K is the total number of deaths per 100.000 inhabitants
+	DeathsPer100K float64
+	// NewConfirmedPer100K is the number of new confirmed cases per 100.000 inhabitants
+	NewConfirmedPer100K float64
+	// NewDeathsPer100K is the number of new deaths per 100.000 inhabitants
+	NewDeathsPer100K float64
+	// ConfirmedAverage is the 7-day average of new confirmed cases
+	ConfirmedAverage float64
+	// DeathsAverage is the 7-day average of new deaths
+	DeathsAverage float64
+}
+
+// NewData creates the template data for an update of a country. If population is zero, the per-100k rates are left at zero
+func NewData(previous, current models.CountryEntry, population int64) Data {
+	data := Data{
+		Name:         current.Name,
+		Code:         current.Code,
+		Previous:     previous,
+		Current:      current,
+		NewConfirmed: current.Confirmed - previous.Confirmed,
+		NewRecovered: current.Recovered - previous.Recovered,
+		NewDeaths:    current.Deaths - previous.Deaths,
+		Population:   population,
+	}
+	if population > 0 {
+		data.ConfirmedPer100K = per100K(current.Confirmed, population)
+		data.DeathsPer100K = per100K(current.Deaths, population)
+		data.NewConfirmedPer100K = per100K(data.NewConfirmed, population)
+		data.NewDeathsPer100K = per100K(data.NewDeaths, population)
+	}
+	return data
+}
+
+func per100K(value, population int64) float64 {
+	return 100000 * float64(value) / float64(population)
+}
+
+// Templates renders the title and body of a notification
+type Templates struct {
+	title *template.Template
+	body  *template.Template
+}
+
+// ParseTemplates parses the title and body templates. If a template is blank, the default template is used.
+// Both templates are executed against sample data, so that references to unknown fields are reported here,
+// rather than when the first notification is sent.
+func ParseTemplates(title, body string) (Templates, error) {
+	if title == "" {
+		title = DefaultTitle
+	}
+	if body == "" {
+		body = DefaultBody
+	}
+
+	var t Templates
+	var err error
+	if t.title, err = parse("title", title); err != nil {
+		return Templates{}, err
+	}
+	if t.body, err = parse("body", body); err != nil {
+		return Templates{}, err
+	}
+	return t, nil
+}
+
+func parse(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s template: %w", name, err)
+	}
+	if err = tmpl.Execute(&bytes.Buffer{}, Data{}); err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// Render returns the title and body of the notification for the provided data. If the templates haven't been parsed,
+// the default templates are used.
+func (t Templates) Render(data Data) (string, string, error) {
+	if t.title == nil || t.body == nil {
+		var err error
+		if t, err = ParseTemplates("", ""); err != nil {
+			return "", "", err
+		}
+	}
+
+	var title, body bytes.Buffer
+	if err := t.title.Execute(&title, data); err != nil {
+		return "", "", fmt.Errorf("title: %w", err)
+	}
+	if err := t.body.Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("body: %w", err)
+	}
+	return title.String(), body.String(), nil
+}
@@ -0,0 +1,68 @@
+package notification_test
+
+import (
+	"github.com/clambin/covid19/covid/notification"
+	"github.com/clambin/covid19/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestNewData(t *testing.T) {
+	previous := models.CountryEntry{Timestamp: time.Date(2023, time.March, 21, 0, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 100, Recovered: 50, Deaths: 25}
+	current := models.CountryEntry{Timestamp: time.Date(2023, time.March, 22, 0, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 300, Recovered: 100, Deaths: 45}
+
+	data := notification.NewData(previous, current, 1000000)
+	assert.Equal(t, "Belgium", data.Name)
+	assert.Equal(t, "BE", data.Code)
+	assert.Equal(t, int64(200), data.NewConfirmed)
+	assert.Equal(t, int64(50), data.NewRecovered)
+	assert.Equal(t, int64(20), data.NewDeaths)
+	assert.Equal(t, 30.0, data.ConfirmedPer100K)
+	assert.Equal(t, 4.5, data.DeathsPer100K)
+	assert.Equal(t, 20.0, data.NewConfirmedPer100K)
+	assert.Equal(t, 2.0, data.NewDeathsPer100K)
+
+	data = notification.NewData(previous, current, 0)
+	assert.Zero(t, data.ConfirmedPer100K)
+	assert.Zero(t, data.NewConfirmedPer100K)
+}
+
+func TestParseTemplates(t *testing.T) {
+	tests := []struct {
+		name      string
+		title     string
+		body      string
+		pass      bool
+		wantTitle string
+		wantBody  string
+	}{
+		{name: "defaults", pass: true, wantTitle: "New data for Belgium", wantBody: "Confirmed: 200, deaths: 20"},
+		{name: "custom", title: "{{.Code}}", body: "{{.Previous.Confirmed}} -> {{.Current.Confirmed}}", pass: true, wantTitle: "BE", wantBody: "100 -> 300"},
+		{name: "syntax error", title: "{{.Code", pass: false},
+		{name: "unknown field", body: "{{.Confirmd}}", pass: false},
+	}
+
+	data := notification.NewData(
+		models.CountryEntry{Code: "BE", Name: "Belgium", Confirmed: 100, Deaths: 25},
+		models.CountryEntry{Code: "BE", Name: "Belgium", Confirmed: 300, Deaths: 45},
+		0,
+	)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templates, err := notification.ParseTemplates(tt.title, tt.body)
+			if !tt.pass {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			title, body, err := templates.Render(data)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantTitle, title)
+			assert.Equal(t, tt.wantBody, body)
+		})
+	}
+}
@@ -1,42 +1,218 @@
 package covid
 
 import (
+	"context"
 	"fmt"
+	"github.com/clambin/covid19/configuration"
+	"github.com/clambin/covid19/covid/notification"
 	"github.com/clambin/covid19/covid/shoutrrr"
 	"github.com/clambin/covid19/models"
 	"github.com/clambin/go-common/set"
 	"golang.org/x/exp/slog"
+	"sort"
+	"time"
 )
 
+// Notifier sends a notification when a selected country gets new data
 type Notifier struct {
 	shoutrrr.Sender
+	// Countries for which to send a notification. If Countries contains configuration.AllCountries, notifications are sent for every country
 	Countries set.Set[string]
+	// Templates renders the notification. If not set, the default templates are used
+	Templates notification.Templates
+	// Store provides the 7-day averages. If nil, averages are left at zero
+	Store DailyGetter
+	// Population provides the population figures for the per-100k rates. If nil, rates are left at zero
+	Population PopulationGetter
+	// Route is the name of the notification route. It identifies the route's records in State
+	Route string
+	// State records the last notified entry per country, so that each update is notified at most once. It also allows
+	// updates deferred during quiet hours to be notified by a later run. If nil, only this run's updates are notified
+	State StateStore
+	// QuietHours defers notifications during a daily period. If nil, notifications are sent immediately
+	QuietHours *notification.QuietHours
+	// Now returns the current time. If nil, time.Now is used
+	Now func() time.Time
 }
 
-func (n Notifier) Notify(current map[string]models.CountryEntry, updates []models.CountryEntry) error {
+// StateStore records the last notified entry per route and country
+type StateStore interface {
+	GetLastNotified(ctx context.Context, route string) (map[string]models.CountryEntry, error)
+	SetLastNotified(ctx context.Context, route string, entry models.CountryEntry) error
+}
+
+// UpdateSender is implemented by senders that send the figures of the update along with the title and body, e.g. webhook.Sender
+type UpdateSender interface {
+	SendUpdate(title, body string, data notification.Data) error
+}
+
+// DailyGetter returns the daily figures for a country
+type DailyGetter interface {
+	GetDailyForCountryName(context.Context, string) ([]models.DailyEntry, error)
+}
+
+// PopulationGetter returns the population figures of each country code by year
+type PopulationGetter interface {
+	ListByYear(context.Context) (models.PopulationHistory, error)
+}
+
+// Notify sends a notification for each selected country that received new data. current contains the latest entries
+// before the update, updates contains the new entries.
+//
+// If State is set, a notification is only sent for entries more recent than the last notified entry. Its state is
+// recorded before the notification is sent, so a failed notification is not retried. Notifications for updates received
+// during quiet hours are sent by the first run outside the quiet hours, with the figures since the last notification.
+func (n Notifier) Notify(ctx context.Context, current map[string]models.CountryEntry, updates []models.CountryEntry) error {
+	notified, err := n.getLastNotified(ctx)
+	if err != nil {
+		return fmt.Errorf("get notification state: %w", err)
+	}
+
+	pending := n.getPending(current, updates, notified)
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if n.QuietHours != nil && n.QuietHours.Contains(n.now()) {
+		n.deferPending(ctx, pending, notified)
+		return nil
+	}
+
+	population := n.getPopulation(ctx)
+	for _, p := range pending {
+		if n.State != nil {
+			if err = n.State.SetLastNotified(ctx, n.Route, p.current); err != nil {
+				slog.Error("failed to record notification state. not sending notification", "err", err, "country", p.current.Name)
+				continue
+			}
+		}
+
+		// rates are calculated against the population of the update's report year
+		pop, _ := population.Get(p.current.Code, p.current.GetReportDate())
+		data := notification.NewData(p.previous, p.current, pop)
+		data.ConfirmedAverage, data.DeathsAverage = n.getAverages(ctx, p.current.Name)
+
+		slog.Info("update", "confirmed", data.NewConfirmed, "deaths", data.NewDeaths)
+
+		title, body, err := n.Templates.Render(data)
+		if err == nil {
+			err = n.send(title, body, data)
+		}
+		if err != nil {
+			slog.Error("failed to send notification", "err", err)
+		}
+	}
+	return nil
+}
+
+type pendingUpdate struct {
+	previous models.CountryEntry
+	current  models.CountryEntry
+}
+
+// getPending returns the entries to notify, with the entry they should be compared to: the last notified entry or,
+// if the country hasn't been notified yet, the latest entry before the update
+func (n Notifier) getPending(current map[string]models.CountryEntry, updates []models.CountryEntry, notified map[string]models.CountryEntry) []pendingUpdate {
+	var pending []pendingUpdate
+	updated := set.Create[string]()
 	for _, update := range updates {
-		if !n.Countries.Contains(update.Name) {
+		if !n.isSelected(update.Name) {
 			continue
 		}
+		updated.Add(update.Name)
 
-		entry, ok := current[update.Name]
+		previous, ok := notified[update.Name]
 		if !ok {
+			if previous, ok = current[update.Name]; !ok {
+				continue
+			}
+		}
+
+		if update.Timestamp.After(previous.Timestamp) {
+			pending = append(pending, pendingUpdate{previous: previous, current: update})
+		}
+	}
+
+	// entries that were received, but not notified, by an earlier run
+	names := make([]string, 0, len(notified))
+	for name := range notified {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if updated.Contains(name) || !n.isSelected(name) {
 			continue
 		}
+		if entry, ok := current[name]; ok && entry.Timestamp.After(notified[name].Timestamp) {
+			pending = append(pending, pendingUpdate{previous: notified[name], current: entry})
+		}
+	}
+	return pending
+}
 
-		if !update.Timestamp.After(entry.Timestamp) {
+// deferPending records the baseline of countries that haven't been notified yet, so that a later run can send the notification
+func (n Notifier) deferPending(ctx context.Context, pending []pendingUpdate, notified map[string]models.CountryEntry) {
+	for _, p := range pending {
+		slog.Info("quiet hours. deferring notification", "country", p.current.Name, "route", n.Route)
+		if n.State == nil {
 			continue
 		}
+		if _, ok := notified[p.current.Name]; !ok {
+			if err := n.State.SetLastNotified(ctx, n.Route, p.previous); err != nil {
+				slog.Error("failed to record notification state", "err", err, "country", p.current.Name)
+			}
+		}
+	}
+}
+
+func (n Notifier) isSelected(name string) bool {
+	return n.Countries.Contains(name) || n.Countries.Contains(configuration.AllCountries)
+}
+
+func (n Notifier) getLastNotified(ctx context.Context) (map[string]models.CountryEntry, error) {
+	if n.State == nil {
+		return map[string]models.CountryEntry{}, nil
+	}
+	return n.State.GetLastNotified(ctx, n.Route)
+}
+
+func (n Notifier) now() time.Time {
+	if n.Now == nil {
+		return time.Now()
+	}
+	return n.Now()
+}
+
+func (n Notifier) send(title, body string, data notification.Data) error {
+	if s, ok := n.Sender.(UpdateSender); ok {
+		return s.SendUpdate(title, body, data)
+	}
+	return n.Sender.Send(title, body)
+}
 
-		slog.Info("update", "confirmed", update.Confirmed-entry.Confirmed, "deaths", update.Deaths-entry.Deaths)
+func (n Notifier) getPopulation(ctx context.Context) models.PopulationHistory {
+	if n.Population == nil {
+		return models.PopulationHistory{}
+	}
+	population, err := n.Population.ListByYear(ctx)
+	if err != nil {
+		slog.Warn("failed to get population figures", "err", err)
+		population = models.PopulationHistory{}
+	}
+	return population
+}
 
-		err := n.Sender.Send(
-			"New data for "+update.Name,
-			fmt.Sprintf("Confirmed: %d, deaths: %d", update.Confirmed-entry.Confirmed, update.Deaths-entry.Deaths),
-		)
+func (n Notifier) getAverages(ctx context.Context, name string) (float64, float64) {
+	if n.Store == nil {
+		return 0, 0
+	}
+	entries, err := n.Store.GetDailyForCountryName(ctx, name)
+	if err != nil || len(entries) == 0 {
 		if err != nil {
-			slog.Error("failed to send notification", "err", err)
+			slog.Warn("failed to get daily figures", "err", err, "country", name)
 		}
+		return 0, 0
 	}
-	return nil
+	last := entries[len(entries)-1]
+	return last.ConfirmedAverage, last.DeathsAverage
 }
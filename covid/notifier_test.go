@@ -1,10 +1,16 @@
 package covid_test
 
 import (
+	"context"
 	"github.com/clambin/covid19/covid"
+	"github.com/clambin/covid19/covid/notification"
 	"github.com/clambin/covid19/covid/shoutrrr/mocks"
+	covid2 "github.com/clambin/covid19/internal/testtools/db/covid"
+	notificationStore "github.com/clambin/covid19/internal/testtools/db/notification"
+	"github.com/clambin/covid19/internal/testtools/db/population"
 	"github.com/clambin/covid19/models"
 	"github.com/clambin/go-common/set"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
 	"time"
@@ -47,6 +53,186 @@ func TestNotifier_Notify(t *testing.T) {
 	}
 
 	s.On("Send", "New data for Belgium", "Confirmed: 100, deaths: 25").Return(nil)
-	err := c.Notify(current, update)
+	err := c.Notify(context.Background(), current, update)
 	require.NoError(t, err)
 }
+
+func TestNotifier_Notify_Templates(t *testing.T) {
+	current := map[string]models.CountryEntry{
+		"Belgium": {Timestamp: time.Date(2023, time.March, 21, 0, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 100, Recovered: 50, Deaths: 25},
+	}
+	update := []models.CountryEntry{
+		{Timestamp: time.Date(2023, time.March, 22, 0, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 200, Recovered: 100, Deaths: 50},
+	}
+
+	templates, err := notification.ParseTemplates(
+		"{{.Name}} ({{.Code}})",
+		`{{.NewConfirmed}} new cases, {{printf "%.1f" .ConfirmedAverage}} avg, {{printf "%.2f" .NewConfirmedPer100K}} per 100k`,
+	)
+	require.NoError(t, err)
+
+	s := mocks.NewSender(t)
+	c := covid.Notifier{
+		Countries:  set.Create("Belgium"),
+		Sender:     s,
+		Templates:  templates,
+		Store:      &covid2.FakeStore{Records: []models.CountryEntry{current["Belgium"], update[0]}},
+		Population: &population.FakeStore{Content: models.PopulationHistory{"BE": {2023: 10000000}}},
+	}
+
+	s.On("Send", "Belgium (BE)", "100 new cases, 100.0 avg, 1.00 per 100k").Return(nil)
+	err = c.Notify(context.Background(), current, update)
+	require.NoError(t, err)
+}
+
+func TestNotifier_Notify_AllCountries(t *testing.T) {
+	s := mocks.NewSender(t)
+	c := covid.Notifier{
+		Countries: set.Create("all"),
+		Sender:    s,
+	}
+
+	current := map[string]models.CountryEntry{
+		"Belgium": {Timestamp: time.Date(2023, time.March, 21, 0, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 100, Deaths: 25},
+		"France":  {Timestamp: time.Date(2023, time.March, 21, 0, 0, 0, 0, time.UTC), Code: "FR", Name: "France", Confirmed: 1000, Deaths: 250},
+	}
+	update := []models.CountryEntry{
+		{Timestamp: time.Date(2023, time.March, 22, 0, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 200, Deaths: 50},
+		{Timestamp: time.Date(2023, time.March, 22, 0, 0, 0, 0, time.UTC), Code: "FR", Name: "France", Confirmed: 2000, Deaths: 500},
+	}
+
+	s.On("Send", "New data for Belgium", "Confirmed: 100, deaths: 25").Return(nil).Once()
+	s.On("Send", "New data for France", "Confirmed: 1000, deaths: 250").Return(nil).Once()
+	err := c.Notify(context.Background(), current, update)
+	require.NoError(t, err)
+}
+
+type updateSender struct {
+	data []notification.Data
+}
+
+func (u *updateSender) Send(_, _ string) error {
+	panic("Send should not be called")
+}
+
+func (u *updateSender) SendUpdate(_, _ string, data notification.Data) error {
+	u.data = append(u.data, data)
+	return nil
+}
+
+func TestNotifier_Notify_UpdateSender(t *testing.T) {
+	s := &updateSender{}
+	c := covid.Notifier{
+		Countries: set.Create("Belgium"),
+		Sender:    s,
+	}
+
+	current := map[string]models.CountryEntry{
+		"Belgium": {Timestamp: time.Date(2023, time.March, 21, 0, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 100, Deaths: 25},
+	}
+	update := []models.CountryEntry{
+		{Timestamp: time.Date(2023, time.March, 22, 0, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 200, Deaths: 50},
+	}
+
+	err := c.Notify(context.Background(), current, update)
+	require.NoError(t, err)
+	require.Len(t, s.data, 1)
+	assert.Equal(t, "BE", s.data[0].Code)
+	assert.Equal(t, int64(100), s.data[0].NewConfirmed)
+}
+
+func TestNotifier_Notify_PopulationYear(t *testing.T) {
+	s := &updateSender{}
+	c := covid.Notifier{
+		Countries:  set.Create("Belgium"),
+		Sender:     s,
+		Population: &population.FakeStore{Content: models.PopulationHistory{"BE": {2021: 5000000, 2023: 10000000}}},
+	}
+
+	// an update for 2022 uses the population figure of 2021, not the latest one
+	current := map[string]models.CountryEntry{
+		"Belgium": {Timestamp: time.Date(2022, time.March, 21, 12, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 100},
+	}
+	update := []models.CountryEntry{
+		{Timestamp: time.Date(2022, time.March, 22, 12, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 200},
+	}
+
+	err := c.Notify(context.Background(), current, update)
+	require.NoError(t, err)
+	require.Len(t, s.data, 1)
+	assert.Equal(t, int64(5000000), s.data[0].Population)
+	assert.Equal(t, 2.0, s.data[0].NewConfirmedPer100K)
+}
+
+func TestNotifier_Notify_AtMostOnce(t *testing.T) {
+	s := mocks.NewSender(t)
+	state := notificationStore.FakeStore{}
+	c := covid.Notifier{
+		Countries: set.Create("Belgium"),
+		Sender:    s,
+		Route:     "default",
+		State:     &state,
+	}
+
+	current := map[string]models.CountryEntry{
+		"Belgium": {Timestamp: time.Date(2023, time.March, 21, 0, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 100, Deaths: 25},
+	}
+	update := []models.CountryEntry{
+		{Timestamp: time.Date(2023, time.March, 22, 0, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 200, Deaths: 50},
+	}
+
+	s.On("Send", "New data for Belgium", "Confirmed: 100, deaths: 25").Return(nil).Once()
+	err := c.Notify(context.Background(), current, update)
+	require.NoError(t, err)
+	assert.Equal(t, update[0], state.Content["default"]["Belgium"])
+
+	// re-processing the same update doesn't send a second notification
+	err = c.Notify(context.Background(), current, update)
+	require.NoError(t, err)
+
+	// if the state can't be read, no notifications are sent
+	state.Fail = true
+	update[0].Timestamp = update[0].Timestamp.Add(24 * time.Hour)
+	err = c.Notify(context.Background(), current, update)
+	assert.Error(t, err)
+}
+
+func TestNotifier_Notify_QuietHours(t *testing.T) {
+	quietHours, err := notification.ParseQuietHours("22:00", "07:00", "")
+	require.NoError(t, err)
+
+	s := mocks.NewSender(t)
+	state := notificationStore.FakeStore{}
+	now := time.Date(2023, time.March, 22, 6, 0, 0, 0, time.UTC)
+	c := covid.Notifier{
+		Countries:  set.Create("Belgium"),
+		Sender:     s,
+		Route:      "default",
+		State:      &state,
+		QuietHours: &quietHours,
+		Now:        func() time.Time { return now },
+	}
+
+	entries := []models.CountryEntry{
+		{Timestamp: time.Date(2023, time.March, 21, 5, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 100, Deaths: 25},
+		{Timestamp: time.Date(2023, time.March, 22, 5, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 200, Deaths: 50},
+		{Timestamp: time.Date(2023, time.March, 22, 6, 30, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 250, Deaths: 55},
+	}
+
+	// during quiet hours: notification is deferred
+	err = c.Notify(context.Background(), map[string]models.CountryEntry{"Belgium": entries[0]}, entries[1:2])
+	require.NoError(t, err)
+	assert.Equal(t, entries[0], state.Content["default"]["Belgium"])
+
+	// next run, during quiet hours: still deferred
+	now = now.Add(30 * time.Minute)
+	err = c.Notify(context.Background(), map[string]models.CountryEntry{"Belgium": entries[1]}, entries[2:3])
+	require.NoError(t, err)
+
+	// next run, outside quiet hours: no new data, but the deferred updates are sent
+	now = now.Add(time.Hour)
+	s.On("Send", "New data for Belgium", "Confirmed: 150, deaths: 30").Return(nil).Once()
+	err = c.Notify(context.Background(), map[string]models.CountryEntry{"Belgium": entries[2]}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, entries[2], state.Content["default"]["Belgium"])
+}
@@ -4,12 +4,19 @@ import (
 	"context"
 	"fmt"
 	"github.com/clambin/covid19/configuration"
+	"github.com/clambin/covid19/covid/alert"
 	"github.com/clambin/covid19/covid/fetcher"
+	"github.com/clambin/covid19/covid/notification"
 	"github.com/clambin/covid19/covid/saver"
 	"github.com/clambin/covid19/covid/shoutrrr"
+	"github.com/clambin/covid19/covid/webhook"
 	"github.com/clambin/covid19/models"
+	"github.com/clambin/covid19/tracing"
+	"github.com/clambin/covid19/tracing/otelrapidapi"
 	"github.com/clambin/go-common/set"
-	"github.com/clambin/go-rapidapi"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/exp/slog"
 	"time"
 )
@@ -18,63 +25,243 @@ import (
 type Probe struct {
 	fetcher.Fetcher
 	saver.StoreSaver
-	*Notifier
+	Notifiers        []*Notifier
+	Digester         *Digester
+	Alerter          *alert.Evaluator
 	invalidCountries set.Set[string]
+	stats            UpdateStats
+	entries          *prometheus.GaugeVec
+	unknownCountries prometheus.Gauge
+	apiErrors        prometheus.Counter
 }
 
+var _ prometheus.Collector = &Probe{}
+
+// UpdateStats counts the entries processed by an update
+type UpdateStats struct {
+	// Fetched is the number of entries received from the COVID-19 API
+	Fetched int
+	// Rejected is the number of entries dropped because their country isn't supported
+	Rejected int
+	// UnknownCountries is the number of distinct unknown country names received from the COVID-19 API
+	UnknownCountries int
+	// New is the number of entries added to the database
+	New int
+}
+
+var tracer = otel.Tracer("github.com/clambin/covid19/covid")
+
 const (
 	rapidAPIHost = "covid-19-coronavirus-statistics.p.rapidapi.com"
 )
 
+// CovidStore is the database used by the Probe to store new data and to look up the figures for notifications
+type CovidStore interface {
+	saver.CovidAdderGetter
+	DigestGetter
+}
+
 // New creates a new Probe
-func New(cfg *configuration.MonitorConfiguration, db saver.CovidAdderGetter) *Probe {
-	var notifier *Notifier
-	if cfg.Notifications.Enabled {
-		router, err := shoutrrr.NewRouter(cfg.Notifications.URL)
+func New(cfg *configuration.MonitorConfiguration, db CovidStore, population PopulationGetter, state StateStore) *Probe {
+	return &Probe{
+		Fetcher:          &fetcher.Client{API: otelrapidapi.New(rapidAPIHost, cfg.RapidAPIKey)},
+		StoreSaver:       saver.StoreSaver{Store: db},
+		Notifiers:        newNotifiers(cfg.Notifications, db, population, state),
+		Digester:         newDigester(cfg.Notifications, db),
+		Alerter:          newAlerter(cfg.Alerts, db, population, state),
+		invalidCountries: set.Create[string](),
+		entries: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "covid",
+			Subsystem: "loader",
+			Name:      "entries",
+			Help:      "Number of entries in the last update, by stage (fetched, rejected, new)",
+		}, []string{"stage"}),
+		unknownCountries: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "covid",
+			Subsystem: "loader",
+			Name:      "unknown_countries",
+			Help:      "Number of unknown country names received from the COVID-19 API in the last update",
+		}),
+		apiErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "covid",
+			Subsystem: "loader",
+			Name:      "api_errors_total",
+			Help:      "Number of failed calls to the COVID-19 API",
+		}),
+	}
+}
+
+func newNotifiers(cfg configuration.NotificationConfiguration, db DailyGetter, population PopulationGetter, state StateStore) []*Notifier {
+	var quietHours *notification.QuietHours
+	if cfg.QuietHours.IsSet() {
+		q, err := notification.ParseQuietHours(cfg.QuietHours.Start, cfg.QuietHours.End, cfg.QuietHours.TimeZone)
 		if err != nil {
-			slog.Error("failed to create notification router", "err", err)
+			slog.Error("invalid quiet hours", "err", err)
 			panic(err)
 		}
-		notifier = &Notifier{
-			Countries: set.Create(cfg.Notifications.Countries...),
-			Sender:    router,
+		quietHours = &q
+	}
+
+	var notifiers []*Notifier
+	for _, route := range cfg.EnabledRoutes() {
+		router, err := NewSender(route)
+		if err != nil {
+			slog.Error("failed to create notification router", "err", err, "route", route.Name)
+			panic(err)
 		}
+		templates, err := notification.ParseTemplates(route.Title, route.Body)
+		if err != nil {
+			slog.Error("invalid notification template", "err", err, "route", route.Name)
+			panic(err)
+		}
+		notifiers = append(notifiers, &Notifier{
+			Sender:     router,
+			Countries:  set.Create(route.Countries...),
+			Templates:  templates,
+			Store:      db,
+			Population: population,
+			Route:      route.Name,
+			State:      state,
+			QuietHours: quietHours,
+		})
+	}
+	return notifiers
+}
 
+// NewSender creates the Sender for a notification route
+func NewSender(route configuration.RouteConfiguration) (shoutrrr.Sender, error) {
+	if route.Type == configuration.RouteTypeWebhook {
+		return webhook.New(route.URL, route.Secret), nil
 	}
-	return &Probe{
-		Fetcher:          &fetcher.Client{API: rapidapi.New(rapidAPIHost, cfg.RapidAPIKey)},
-		StoreSaver:       saver.StoreSaver{Store: db},
-		Notifier:         notifier,
-		invalidCountries: set.Create[string](),
+	return shoutrrr.NewRouter(route.URL)
+}
+
+func newDigester(cfg configuration.NotificationConfiguration, db DigestGetter) *Digester {
+	if !cfg.Digest.Enabled {
+		return nil
+	}
+	router, err := shoutrrr.NewRouter(cfg.URL)
+	if err != nil {
+		slog.Error("failed to create digest router", "err", err)
+		panic(err)
+	}
+	return &Digester{
+		Sender:    router,
+		Countries: cfg.Countries,
+		Format:    cfg.Digest.Format,
+		Store:     db,
 	}
 }
 
+func newAlerter(cfg []configuration.AlertConfiguration, db DailyGetter, population PopulationGetter, state StateStore) *alert.Evaluator {
+	if len(cfg) == 0 {
+		return nil
+	}
+	rules := make([]alert.Rule, len(cfg))
+	for idx, a := range cfg {
+		router, err := shoutrrr.NewRouter(a.URL)
+		if err != nil {
+			slog.Error("failed to create alert router", "err", err, "alert", a.Name)
+			panic(err)
+		}
+		rules[idx] = alert.Rule{
+			Name:            a.Name,
+			Countries:       a.Countries,
+			Region:          a.Region,
+			Severity:        a.Severity,
+			NewCases:        a.NewCases,
+			AverageIncrease: a.AverageIncrease,
+			Incidence:       a.Incidence,
+			Sender:          router,
+		}
+	}
+	return &alert.Evaluator{Rules: rules, Store: db, Population: population, State: state}
+}
+
 // Update gets new COVID-19 stats for each country and, if they are new, adds them to the database
-func (p *Probe) Update(ctx context.Context) (int, error) {
-	current, err := p.StoreSaver.Store.GetLatestForCountries(time.Time{})
+func (p *Probe) Update(ctx context.Context) (count int, err error) {
+	ctx, span := tracer.Start(ctx, "covid.Update")
+	defer func() { _ = tracing.End(span, err) }()
+	p.stats = UpdateStats{}
+
+	current, err := p.StoreSaver.Store.GetLatestForCountries(ctx, time.Time{})
 	if err != nil {
 		return 0, fmt.Errorf("get latest: %w", err)
 	}
 
-	countryStats, err := p.Fetcher.Fetch(ctx)
+	countryStats, err := p.fetch(ctx)
 	if err == nil {
-		countryStats, err = p.StoreSaver.SaveNewEntries(p.filterUnsupportedCountries(countryStats))
+		countryStats, err = p.save(ctx, p.filter(ctx, countryStats))
 	}
 
 	if err != nil {
 		return 0, fmt.Errorf("update: %w", err)
 	}
 
-	if p.Notifier != nil {
-		if err = p.Notify(current, countryStats); err != nil {
+	p.notify(ctx, current, countryStats)
+	return len(countryStats), nil
+}
+
+// Stats returns the counts of the last update, also if it failed
+func (p *Probe) Stats() UpdateStats {
+	return p.stats
+}
+
+func (p *Probe) fetch(ctx context.Context) ([]models.CountryEntry, error) {
+	ctx, span := tracer.Start(ctx, "fetch")
+	entries, err := p.Fetcher.Fetch(ctx)
+	if err != nil {
+		p.apiErrors.Inc()
+	}
+	p.stats.Fetched = len(entries)
+	p.entries.WithLabelValues("fetched").Set(float64(len(entries)))
+	span.SetAttributes(attribute.Int("entries", len(entries)))
+	return entries, tracing.End(span, err)
+}
+
+func (p *Probe) filter(ctx context.Context, entries []models.CountryEntry) []models.CountryEntry {
+	_, span := tracer.Start(ctx, "filter")
+	defer span.End()
+	filtered := p.filterUnsupportedCountries(entries)
+	p.stats.Rejected = len(entries) - len(filtered)
+	p.entries.WithLabelValues("rejected").Set(float64(p.stats.Rejected))
+	span.SetAttributes(attribute.Int("entries", len(filtered)))
+	return filtered
+}
+
+func (p *Probe) save(ctx context.Context, entries []models.CountryEntry) ([]models.CountryEntry, error) {
+	ctx, span := tracer.Start(ctx, "save")
+	saved, err := p.StoreSaver.SaveNewEntries(ctx, entries)
+	p.stats.New = len(saved)
+	p.entries.WithLabelValues("new").Set(float64(len(saved)))
+	span.SetAttributes(attribute.Int("entries", len(saved)))
+	return saved, tracing.End(span, err)
+}
+
+func (p *Probe) notify(ctx context.Context, current map[string]models.CountryEntry, countryStats []models.CountryEntry) {
+	ctx, span := tracer.Start(ctx, "notify")
+	defer span.End()
+
+	for _, notifier := range p.Notifiers {
+		if err := notifier.Notify(ctx, current, countryStats); err != nil {
 			slog.Error("failed to send notification", "err", err)
 		}
 	}
-	return len(countryStats), nil
+	if p.Digester != nil {
+		if err := p.Digester.Notify(ctx, countryStats); err != nil {
+			slog.Error("failed to send digest", "err", err)
+		}
+	}
+	if p.Alerter != nil {
+		if err := p.Alerter.Notify(ctx, countryStats); err != nil {
+			slog.Error("failed to evaluate alerts", "err", err)
+		}
+	}
 }
 
 func (p *Probe) filterUnsupportedCountries(entries []models.CountryEntry) []models.CountryEntry {
 	filteredEntries := make([]models.CountryEntry, 0, len(entries))
+	unknown := set.Create[string]()
 	for _, entry := range entries {
 		code, found := CountryCodes[entry.Name]
 		if !found {
@@ -82,10 +269,27 @@ func (p *Probe) filterUnsupportedCountries(entries []models.CountryEntry) []mode
 				slog.Warn("unknown country name received from COVID-19 API", "name", entry.Name)
 				p.invalidCountries.Add(entry.Name)
 			}
+			unknown.Add(entry.Name)
 			continue
 		}
 		entry.Code = code
 		filteredEntries = append(filteredEntries, entry)
 	}
+	p.stats.UnknownCountries = len(unknown)
+	p.unknownCountries.Set(float64(len(unknown)))
 	return filteredEntries
 }
+
+// Describe implements the prometheus.Collector interface
+func (p *Probe) Describe(descs chan<- *prometheus.Desc) {
+	p.entries.Describe(descs)
+	p.unknownCountries.Describe(descs)
+	p.apiErrors.Describe(descs)
+}
+
+// Collect implements the prometheus.Collector interface
+func (p *Probe) Collect(metrics chan<- prometheus.Metric) {
+	p.entries.Collect(metrics)
+	p.unknownCountries.Collect(metrics)
+	p.apiErrors.Collect(metrics)
+}
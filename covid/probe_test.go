@@ -2,15 +2,18 @@ package covid_test
 
 import (
 	"context"
+	"errors"
 	"github.com/clambin/covid19/configuration"
 	"github.com/clambin/covid19/covid"
 	mockFetcher "github.com/clambin/covid19/covid/fetcher/mocks"
 	mockRouter "github.com/clambin/covid19/covid/shoutrrr/mocks"
 	covid2 "github.com/clambin/covid19/internal/testtools/db/covid"
 	"github.com/clambin/covid19/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"strings"
 	"testing"
 	"time"
 )
@@ -33,10 +36,11 @@ func TestCovid19Probe_Update(t *testing.T) {
 	f := mockFetcher.NewFetcher(t)
 	s := mockRouter.NewSender(t)
 
-	p := covid.New(&cfg, &fdb)
+	p := covid.New(&cfg, &fdb, nil, nil)
 	p.Fetcher = f
 	p.StoreSaver.Store = &fdb
-	p.Notifier.Sender = s
+	require.Len(t, p.Notifiers, 1)
+	p.Notifiers[0].Sender = s
 
 	countryStats := []models.CountryEntry{
 		{Timestamp: timeStamp.Add(-24 * time.Hour), Name: "Belgium", Code: "BE", Confirmed: 8, Deaths: 1, Recovered: 1},
@@ -45,7 +49,7 @@ func TestCovid19Probe_Update(t *testing.T) {
 	}
 
 	f.
-		On("Fetch", mock.AnythingOfType("*context.emptyCtx")).
+		On("Fetch", mock.Anything).
 		Return(countryStats, nil).
 		Once()
 	s.
@@ -56,12 +60,129 @@ func TestCovid19Probe_Update(t *testing.T) {
 	_, err := p.Update(context.Background())
 	require.NoError(t, err)
 
-	latest, err := fdb.GetLatestForCountries(time.Time{})
+	latest, err := fdb.GetLatestForCountries(context.Background(), time.Time{})
 	require.NoError(t, err)
 	assert.Equal(t, map[string]models.CountryEntry{
 		"Belgium": {Timestamp: timeStamp, Code: "BE", Name: "Belgium", Confirmed: 10, Recovered: 1, Deaths: 2},
 		"US":      {Timestamp: timeStamp.Add(24 * time.Hour), Code: "US", Name: "US", Confirmed: 120, Recovered: 15, Deaths: 25},
 	}, latest)
+	assert.Equal(t, covid.UpdateStats{Fetched: 3, Rejected: 1, UnknownCountries: 1, New: 1}, p.Stats())
+
+	assert.NoError(t, testutil.CollectAndCompare(p, strings.NewReader(`
+# HELP covid_loader_api_errors_total Number of failed calls to the COVID-19 API
+# TYPE covid_loader_api_errors_total counter
+covid_loader_api_errors_total 0
+# HELP covid_loader_entries Number of entries in the last update, by stage (fetched, rejected, new)
+# TYPE covid_loader_entries gauge
+covid_loader_entries{stage="fetched"} 3
+covid_loader_entries{stage="new"} 1
+covid_loader_entries{stage="rejected"} 1
+# HELP covid_loader_unknown_countries Number of unknown country names received from the COVID-19 API in the last update
+# TYPE covid_loader_unknown_countries gauge
+covid_loader_unknown_countries 1
+`)))
+}
+
+func TestCovid19Probe_Update_FetchFailure(t *testing.T) {
+	cfg := configuration.MonitorConfiguration{RapidAPIKey: "1234"}
+	fdb := covid2.FakeStore{}
+	f := mockFetcher.NewFetcher(t)
+
+	p := covid.New(&cfg, &fdb, nil, nil)
+	p.Fetcher = f
+
+	f.On("Fetch", mock.Anything).Return(nil, errors.New("fail")).Once()
+
+	_, err := p.Update(context.Background())
+	require.Error(t, err)
+
+	assert.NoError(t, testutil.CollectAndCompare(p, strings.NewReader(`
+# HELP covid_loader_api_errors_total Number of failed calls to the COVID-19 API
+# TYPE covid_loader_api_errors_total counter
+covid_loader_api_errors_total 1
+`), "covid_loader_api_errors_total"))
+}
+
+func TestCovid19Probe_Update_Routes(t *testing.T) {
+	cfg := configuration.MonitorConfiguration{
+		RapidAPIKey: "1234",
+		Notifications: configuration.NotificationConfiguration{
+			Routes: []configuration.RouteConfiguration{
+				{Name: "be", Enabled: true, URL: "slack://T0000000000/B0000000000/I00000000000000000000000", Countries: []string{"Belgium"}, Title: "BE: {{.Name}}"},
+				{Name: "us", Enabled: true, URL: "slack://T0000000000/B0000000000/I00000000000000000000000", Countries: []string{"US"}, Title: "US: {{.Name}}"},
+				{Name: "off", Enabled: false, URL: "slack://T0000000000/B0000000000/I00000000000000000000000", Countries: []string{"all"}},
+			},
+		},
+	}
+
+	timeStamp := time.Now()
+	fdb := covid2.FakeStore{Records: []models.CountryEntry{
+		{Timestamp: timeStamp, Name: "Belgium", Code: "BE", Confirmed: 10, Deaths: 2, Recovered: 1},
+		{Timestamp: timeStamp, Name: "US", Code: "US", Confirmed: 100, Deaths: 20, Recovered: 10},
+	}}
+	f := mockFetcher.NewFetcher(t)
+	be := mockRouter.NewSender(t)
+	us := mockRouter.NewSender(t)
+
+	p := covid.New(&cfg, &fdb, nil, nil)
+	p.Fetcher = f
+	require.Len(t, p.Notifiers, 2)
+	p.Notifiers[0].Sender = be
+	p.Notifiers[1].Sender = us
+
+	f.
+		On("Fetch", mock.Anything).
+		Return([]models.CountryEntry{
+			{Timestamp: timeStamp.Add(24 * time.Hour), Name: "Belgium", Confirmed: 12, Deaths: 2, Recovered: 1},
+			{Timestamp: timeStamp.Add(24 * time.Hour), Name: "US", Confirmed: 120, Deaths: 25, Recovered: 15},
+		}, nil).
+		Once()
+	be.On("Send", "BE: Belgium", "Confirmed: 2, deaths: 0").Return(nil).Once()
+	us.On("Send", "US: US", "Confirmed: 20, deaths: 5").Return(nil).Once()
+
+	_, err := p.Update(context.Background())
+	require.NoError(t, err)
+}
+
+func TestCovid19Probe_Update_Alerts(t *testing.T) {
+	cfg := configuration.MonitorConfiguration{
+		RapidAPIKey: "1234",
+		Alerts: []configuration.AlertConfiguration{{
+			Name:      "cases",
+			Countries: []string{"US"},
+			URL:       "slack://T0000000000/B0000000000/I00000000000000000000000",
+			Severity:  "critical",
+			NewCases:  10,
+		}},
+	}
+
+	timeStamp := time.Date(2023, time.March, 22, 12, 0, 0, 0, time.UTC)
+	// the rule starts firing with the update: the day before, there were only 5 new cases
+	fdb := covid2.FakeStore{Records: []models.CountryEntry{
+		{Timestamp: timeStamp.Add(-24 * time.Hour), Name: "US", Code: "US", Confirmed: 95, Deaths: 20, Recovered: 10},
+		{Timestamp: timeStamp, Name: "US", Code: "US", Confirmed: 100, Deaths: 20, Recovered: 10},
+	}}
+	f := mockFetcher.NewFetcher(t)
+	s := mockRouter.NewSender(t)
+
+	p := covid.New(&cfg, &fdb, nil, nil)
+	p.Fetcher = f
+	require.NotNil(t, p.Alerter)
+	require.Len(t, p.Alerter.Rules, 1)
+	p.Alerter.Rules[0].Sender = s
+
+	f.
+		On("Fetch", mock.Anything).
+		Return([]models.CountryEntry{{Timestamp: timeStamp.Add(24 * time.Hour), Name: "US", Confirmed: 120, Deaths: 25, Recovered: 15}}, nil).
+		Once()
+	s.
+		On("Send", "[critical] cases: US", "new cases: 20 (threshold: 10)").
+		Return(nil).
+		Once()
+
+	count, err := p.Update(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
 }
 
 /*
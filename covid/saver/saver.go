@@ -1,6 +1,7 @@
 package saver
 
 import (
+	"context"
 	"fmt"
 	"github.com/clambin/covid19/models"
 	"golang.org/x/exp/slog"
@@ -13,25 +14,25 @@ type StoreSaver struct {
 }
 
 type CovidAdderGetter interface {
-	Add([]models.CountryEntry) error
-	GetLatestForCountries(time.Time) (map[string]models.CountryEntry, error)
+	Add(context.Context, []models.CountryEntry) error
+	GetLatestForCountries(context.Context, time.Time) (map[string]models.CountryEntry, error)
 }
 
 // SaveNewEntries takes a list of entries and adds any newer stats to the database
-func (s *StoreSaver) SaveNewEntries(entries []models.CountryEntry) ([]models.CountryEntry, error) {
-	newEntries, err := s.getNewRecords(entries)
+func (s *StoreSaver) SaveNewEntries(ctx context.Context, entries []models.CountryEntry) ([]models.CountryEntry, error) {
+	newEntries, err := s.getNewRecords(ctx, entries)
 	if err != nil || len(newEntries) == 0 {
 		return nil, err
 	}
 	slog.Debug("adding new probe-19 data to the database", "entries", len(newEntries))
-	if err = s.Store.Add(newEntries); err != nil {
+	if err = s.Store.Add(ctx, newEntries); err != nil {
 		err = fmt.Errorf("add: %w", err)
 	}
 	return newEntries, err
 }
 
-func (s *StoreSaver) getNewRecords(entries []models.CountryEntry) ([]models.CountryEntry, error) {
-	latest, err := s.Store.GetLatestForCountries(time.Time{})
+func (s *StoreSaver) getNewRecords(ctx context.Context, entries []models.CountryEntry) ([]models.CountryEntry, error) {
+	latest, err := s.Store.GetLatestForCountries(ctx, time.Time{})
 	if err != nil {
 		return nil, err
 	}
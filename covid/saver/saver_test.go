@@ -1,6 +1,7 @@
 package saver_test
 
 import (
+	"context"
 	"github.com/clambin/covid19/covid/saver"
 	"github.com/clambin/covid19/internal/testtools/db/covid"
 	"github.com/clambin/covid19/models"
@@ -18,7 +19,7 @@ func TestStoreSaver_SaveNewEntries(t *testing.T) {
 	}}
 	s := saver.StoreSaver{Store: &f}
 
-	newEntries, err := s.SaveNewEntries([]models.CountryEntry{
+	newEntries, err := s.SaveNewEntries(context.Background(), []models.CountryEntry{
 		{Timestamp: timeStamp.Add(-24 * time.Hour), Name: "Belgium", Code: "BE", Confirmed: 8, Deaths: 1, Recovered: 0},
 		{Timestamp: timeStamp.Add(24 * time.Hour), Name: "US", Code: "US", Confirmed: 120, Deaths: 25, Recovered: 10},
 	})
@@ -26,7 +27,7 @@ func TestStoreSaver_SaveNewEntries(t *testing.T) {
 	require.NoError(t, err)
 	require.Len(t, newEntries, 1)
 
-	n, err := s.Store.GetLatestForCountries(time.Time{})
+	n, err := s.Store.GetLatestForCountries(context.Background(), time.Time{})
 	require.NoError(t, err)
 	assert.Equal(t, map[string]models.CountryEntry{
 		"Belgium": {Timestamp: timeStamp, Code: "BE", Name: "Belgium", Confirmed: 10, Recovered: 1, Deaths: 2},
@@ -42,7 +43,7 @@ func TestStoreSaver_SaveNewEntries_Errors(t *testing.T) {
 	}}
 	s := saver.StoreSaver{Store: &f}
 
-	_, err := s.SaveNewEntries([]models.CountryEntry{
+	_, err := s.SaveNewEntries(context.Background(), []models.CountryEntry{
 		{Timestamp: timeStamp.Add(-24 * time.Hour), Name: "Belgium", Code: "BE", Confirmed: 8, Deaths: 1, Recovered: 0},
 		{Timestamp: timeStamp.Add(24 * time.Hour), Name: "US", Code: "US", Confirmed: 120, Deaths: 25, Recovered: 10},
 	})
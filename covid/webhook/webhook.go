@@ -0,0 +1,166 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/clambin/covid19/covid/notification"
+	"github.com/clambin/covid19/models"
+	"github.com/clambin/covid19/pkg/retry"
+	"io"
+	"net/http"
+	"time"
+)
+
+// PayloadVersion is the version of the JSON document sent by the webhook. It is increased whenever the layout of Payload changes
+const PayloadVersion = 1
+
+// SignatureHeader contains the HMAC-SHA256 signature of the request body, as "sha256=<hex digest>"
+const SignatureHeader = "X-Covid19-Signature"
+
+// Payload is the JSON document posted to the webhook
+type Payload struct {
+	Version   int        `json:"version"`
+	Sent      time.Time  `json:"sent"`
+	Title     string     `json:"title"`
+	Message   string     `json:"message"`
+	Country   string     `json:"country,omitempty"`
+	Code      string     `json:"code,omitempty"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	Previous  *Figures   `json:"previous,omitempty"`
+	Current   *Figures   `json:"current,omitempty"`
+	Delta     *Figures   `json:"delta,omitempty"`
+}
+
+// Figures contains the figures of a country
+type Figures struct {
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	Confirmed int64      `json:"confirmed"`
+	Recovered int64      `json:"recovered"`
+	Deaths    int64      `json:"deaths"`
+}
+
+func makeFigures(entry models.CountryEntry) *Figures {
+	timestamp := entry.Timestamp.UTC()
+	return &Figures{Timestamp: &timestamp, Confirmed: entry.Confirmed, Recovered: entry.Recovered, Deaths: entry.Deaths}
+}
+
+// Sender posts notifications to a webhook as a JSON document
+type Sender struct {
+	URL string
+	// Secret signs the request body. If blank, requests are not signed
+	Secret string
+	// MaxRetries is the number of times a failed request is retried
+	MaxRetries int
+	// Delay before the first retry. The delay doubles with each retry
+	Delay      time.Duration
+	HTTPClient *http.Client
+}
+
+const (
+	defaultMaxRetries = 5
+	defaultDelay      = 250 * time.Millisecond
+	maxDelay          = 5 * time.Second
+)
+
+// New creates a new Sender
+func New(url, secret string) *Sender {
+	return &Sender{
+		URL:        url,
+		Secret:     secret,
+		MaxRetries: defaultMaxRetries,
+		Delay:      defaultDelay,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Send posts a notification without country figures
+func (s *Sender) Send(title, message string) error {
+	return s.post(Payload{Title: title, Message: message})
+}
+
+// SendUpdate posts a notification with the figures of a country update
+func (s *Sender) SendUpdate(title, message string, data notification.Data) error {
+	timestamp := data.Current.Timestamp.UTC()
+	return s.post(Payload{
+		Title:     title,
+		Message:   message,
+		Country:   data.Name,
+		Code:      data.Code,
+		Timestamp: &timestamp,
+		Previous:  makeFigures(data.Previous),
+		Current:   makeFigures(data.Current),
+		Delta:     &Figures{Confirmed: data.NewConfirmed, Recovered: data.NewRecovered, Deaths: data.NewDeaths},
+	})
+}
+
+func (s *Sender) post(payload Payload) error {
+	payload.Version = PayloadVersion
+	payload.Sent = time.Now().UTC()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+
+	r := retry.Retry{
+		BackOff:     retry.NewDoublerBackoff(s.MaxRetries, s.Delay, maxDelay),
+		ShouldRetry: shouldRetry,
+	}
+	return r.Do(func() error { return s.do(body) })
+}
+
+func (s *Sender) do(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(body, s.Secret))
+	}
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	err = fmt.Errorf("post: %s", resp.Status)
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		err = &permanentError{err: err}
+	}
+	return err
+}
+
+// Sign returns the signature of a request body, as sent in the SignatureHeader
+func Sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// permanentError is returned for failures that won't be fixed by retrying the request
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+func shouldRetry(err error) bool {
+	var permanent *permanentError
+	return !errors.As(err, &permanent)
+}
@@ -0,0 +1,102 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"github.com/clambin/covid19/covid/notification"
+	"github.com/clambin/covid19/covid/webhook"
+	"github.com/clambin/covid19/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSender_SendUpdate(t *testing.T) {
+	var payload webhook.Payload
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, webhook.Sign(body, "secret"), r.Header.Get(webhook.SignatureHeader))
+		require.NoError(t, json.Unmarshal(body, &payload))
+	}))
+	defer s.Close()
+
+	previous := models.CountryEntry{Timestamp: time.Date(2023, time.March, 21, 0, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 100, Recovered: 50, Deaths: 25}
+	current := models.CountryEntry{Timestamp: time.Date(2023, time.March, 22, 0, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 200, Recovered: 100, Deaths: 50}
+
+	sender := webhook.New(s.URL, "secret")
+	err := sender.SendUpdate("New data for Belgium", "Confirmed: 100, deaths: 25", notification.NewData(previous, current, 0))
+	require.NoError(t, err)
+
+	assert.Equal(t, webhook.PayloadVersion, payload.Version)
+	assert.NotZero(t, payload.Sent)
+	assert.Equal(t, "New data for Belgium", payload.Title)
+	assert.Equal(t, "Confirmed: 100, deaths: 25", payload.Message)
+	assert.Equal(t, "Belgium", payload.Country)
+	assert.Equal(t, "BE", payload.Code)
+	require.NotNil(t, payload.Timestamp)
+	assert.Equal(t, current.Timestamp, *payload.Timestamp)
+	require.NotNil(t, payload.Previous)
+	assert.Equal(t, int64(100), payload.Previous.Confirmed)
+	require.NotNil(t, payload.Current)
+	assert.Equal(t, int64(200), payload.Current.Confirmed)
+	assert.Equal(t, &webhook.Figures{Confirmed: 100, Recovered: 50, Deaths: 25}, payload.Delta)
+}
+
+func TestSender_Send(t *testing.T) {
+	var body map[string]any
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get(webhook.SignatureHeader))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+	}))
+	defer s.Close()
+
+	err := webhook.New(s.URL, "").Send("covid19 loader failed", "db error")
+	require.NoError(t, err)
+	assert.Equal(t, "covid19 loader failed", body["title"])
+	assert.Equal(t, "db error", body["message"])
+	assert.NotContains(t, body, "country")
+	assert.NotContains(t, body, "timestamp")
+	assert.NotContains(t, body, "delta")
+}
+
+func TestSender_Retry(t *testing.T) {
+	tests := []struct {
+		name   string
+		status []int
+		pass   bool
+		calls  int32
+	}{
+		{name: "recovers", status: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, pass: true, calls: 3},
+		{name: "gives up", status: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}, pass: false, calls: 3},
+		{name: "permanent", status: []int{http.StatusUnauthorized, http.StatusOK}, pass: false, calls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status[calls.Add(1)-1])
+			}))
+			defer s.Close()
+
+			sender := webhook.New(s.URL, "secret")
+			sender.MaxRetries = 2
+			sender.Delay = time.Millisecond
+
+			err := sender.Send("foo", "bar")
+			if tt.pass {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+			assert.Equal(t, tt.calls, calls.Load())
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestReadManifest(t *testing.T) {
+	latest, err := latestMigration()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		manifest *BackupManifest
+		tables   []string
+		pass     bool
+	}{
+		{
+			name:     "valid",
+			manifest: &BackupManifest{Format: BackupFormat, SchemaVersion: latest, Rows: map[string]int64{"covid19": 1}},
+			tables:   []string{"covid19", "population"},
+			pass:     true,
+		},
+		{
+			name:     "older schema",
+			manifest: &BackupManifest{Format: BackupFormat, SchemaVersion: latest - 1},
+			tables:   []string{"covid19", "population"},
+			pass:     true,
+		},
+		{
+			name:   "missing manifest",
+			tables: []string{"covid19", "population"},
+		},
+		{
+			name:     "newer format",
+			manifest: &BackupManifest{Format: BackupFormat + 1, SchemaVersion: latest},
+			tables:   []string{"covid19", "population"},
+		},
+		{
+			name:     "newer schema",
+			manifest: &BackupManifest{Format: BackupFormat, SchemaVersion: latest + 1},
+			tables:   []string{"covid19", "population"},
+		},
+		{
+			name:     "missing table",
+			manifest: &BackupManifest{Format: BackupFormat, SchemaVersion: latest},
+			tables:   []string{"covid19"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var archive bytes.Buffer
+			zw := zip.NewWriter(&archive)
+			if tt.manifest != nil {
+				f, err := zw.Create(manifestFile)
+				require.NoError(t, err)
+				require.NoError(t, json.NewEncoder(f).Encode(tt.manifest))
+			}
+			for _, table := range tt.tables {
+				_, err := zw.Create(table + ".csv")
+				require.NoError(t, err)
+			}
+			require.NoError(t, zw.Close())
+
+			zr, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+			require.NoError(t, err)
+			files := make(map[string]*zip.File)
+			for _, f := range zr.File {
+				files[f.Name] = f
+			}
+
+			manifest, err := readManifest(files)
+			if !tt.pass {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, *tt.manifest, manifest)
+		})
+	}
+}
@@ -0,0 +1,340 @@
+package db
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/clambin/covid19/tracing"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"io"
+	"time"
+)
+
+// BackupFormat is the version of the layout of the archives written by Backup
+const BackupFormat = 1
+
+// BackupManifest describes the contents of a backup archive
+type BackupManifest struct {
+	// Format is the version of the archive layout
+	Format int `json:"format"`
+	// SchemaVersion is the schema version of the database that was backed up
+	SchemaVersion uint      `json:"schemaVersion"`
+	Created       time.Time `json:"created"`
+	// Rows is the number of rows of each table in the archive
+	Rows map[string]int64 `json:"rows"`
+}
+
+// ErrNotEmpty indicates that a backup can't be restored, as the database already holds figures
+var ErrNotEmpty = errors.New("database is not empty")
+
+const manifestFile = "manifest.json"
+
+// backupTable is a table included in the backup archive, as <name>.csv
+type backupTable struct {
+	name    string
+	columns []string
+	// query returns the table's rows, with the columns in the same order as columns
+	query string
+}
+
+// backupTables lists the tables in the backup archive. The covid19 rows aren't linked to their loader run, as the audit
+// log isn't included.
+var backupTables = []backupTable{
+	{
+		name:    "covid19",
+		columns: []string{"time", "report_date", "country_code", "country_name", "confirmed", "death", "recovered"},
+		query:   `SELECT time, report_date::TEXT, country_code, country_name, confirmed, death, recovered FROM covid19 ORDER BY time, country_name`,
+	},
+	{
+		name:    "population",
+		columns: []string{"country_code", "year", "population"},
+		query:   `SELECT country_code, year, population FROM population ORDER BY country_code, year`,
+	},
+}
+
+// Backup writes the covid19 and population tables to w, as a zip archive holding a CSV file per table and a manifest.
+// All tables are read from the same snapshot, so the loader can keep running. The database schema must be up to date.
+func (db *DB) Backup(ctx context.Context, w io.Writer) (manifest BackupManifest, err error) {
+	ctx, span := db.startSpan(ctx, "DB.Backup")
+	defer func() { _ = tracing.End(span, err) }()
+
+	status, err := db.MigrationStatus(ctx)
+	if err != nil {
+		return manifest, fmt.Errorf("migration status: %w", err)
+	}
+	if status.Dirty || status.Pending() > 0 {
+		return manifest, fmt.Errorf("database schema is at version %d (dirty: %t), latest is %d: run 'db migrate up' first", status.Version, status.Dirty, status.Latest)
+	}
+
+	tx, err := db.primaryHandle().BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return manifest, err
+	}
+	defer func() {
+		// read-only: nothing to commit
+		_ = tx.Rollback()
+	}()
+	// write all timestamps in UTC
+	if _, err = tx.ExecContext(ctx, `SET LOCAL TIME ZONE 'UTC'`); err != nil {
+		return manifest, err
+	}
+
+	manifest = BackupManifest{
+		Format:        BackupFormat,
+		SchemaVersion: status.Version,
+		Created:       time.Now().UTC(),
+		Rows:          make(map[string]int64),
+	}
+	zw := zip.NewWriter(w)
+	for _, table := range backupTables {
+		var f io.Writer
+		if f, err = zw.Create(table.name + ".csv"); err != nil {
+			return manifest, err
+		}
+		if manifest.Rows[table.name], err = dumpTable(ctx, tx, table, f); err != nil {
+			return manifest, fmt.Errorf("%s: %w", table.name, err)
+		}
+	}
+
+	f, err := zw.Create(manifestFile)
+	if err != nil {
+		return manifest, err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(manifest); err != nil {
+		return manifest, err
+	}
+	return manifest, zw.Close()
+}
+
+func dumpTable(ctx context.Context, tx *sqlx.Tx, table backupTable, w io.Writer) (count int64, err error) {
+	rows, err := tx.QueryContext(ctx, table.query)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	cw := csv.NewWriter(w)
+	if err = cw.Write(table.columns); err != nil {
+		return 0, err
+	}
+	values := make([]sql.NullString, len(table.columns))
+	dest := make([]any, len(values))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	record := make([]string, len(values))
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return count, err
+		}
+		// NULL values are written as empty fields
+		for i, value := range values {
+			record[i] = value.String
+		}
+		if err = cw.Write(record); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err = rows.Err(); err != nil {
+		return count, err
+	}
+	cw.Flush()
+	return count, cw.Error()
+}
+
+// Restore loads a backup archive written by Backup into an empty database. Any pending migrations are applied first.
+// Restore fails if the archive was written by a newer version of covid19, or if the database already holds figures.
+func (db *DB) Restore(ctx context.Context, r io.ReaderAt, size int64) (manifest BackupManifest, err error) {
+	ctx, span := db.startSpan(ctx, "DB.Restore")
+	defer func() { _ = tracing.End(span, err) }()
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return manifest, fmt.Errorf("archive: %w", err)
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	if manifest, err = readManifest(files); err != nil {
+		return manifest, fmt.Errorf("archive: %w", err)
+	}
+
+	if err = db.MigrateUp(ctx); err != nil {
+		return manifest, fmt.Errorf("migrate: %w", err)
+	}
+
+	tx, err := db.primaryHandle().BeginTxx(ctx, nil)
+	if err != nil {
+		return manifest, err
+	}
+	defer func() {
+		// will be ignored if we commit before the function returns
+		_ = tx.Rollback()
+	}()
+
+	// keep the loader out until the archive is restored
+	if _, err = tx.ExecContext(ctx, `LOCK TABLE covid19, population IN EXCLUSIVE MODE`); err != nil {
+		return manifest, err
+	}
+	for _, table := range backupTables {
+		var rows int64
+		if err = tx.GetContext(ctx, &rows, `SELECT COUNT(*) FROM `+table.name); err != nil {
+			return manifest, err
+		}
+		if rows > 0 {
+			return manifest, fmt.Errorf("%s: %w", table.name, ErrNotEmpty)
+		}
+	}
+
+	months, err := readPartitionMonths(files["covid19.csv"])
+	if err != nil {
+		return manifest, fmt.Errorf("covid19: %w", err)
+	}
+	if err = createPartitions(ctx, tx, months); err != nil {
+		return manifest, err
+	}
+	for _, table := range backupTables {
+		if err = loadTable(ctx, tx, table, files[table.name+".csv"], manifest.Rows[table.name]); err != nil {
+			return manifest, fmt.Errorf("%s: %w", table.name, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return manifest, err
+	}
+	db.refreshViews(ctx)
+	return manifest, nil
+}
+
+// readManifest reads the manifest of a backup archive and checks that the archive can be restored
+func readManifest(files map[string]*zip.File) (manifest BackupManifest, err error) {
+	f, ok := files[manifestFile]
+	if !ok {
+		return manifest, fmt.Errorf("%s not found", manifestFile)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return manifest, err
+	}
+	defer func() { _ = rc.Close() }()
+	if err = json.NewDecoder(rc).Decode(&manifest); err != nil {
+		return manifest, fmt.Errorf("%s: %w", manifestFile, err)
+	}
+
+	if manifest.Format != BackupFormat {
+		return manifest, fmt.Errorf("unsupported format %d", manifest.Format)
+	}
+	latest, err := latestMigration()
+	if err != nil {
+		return manifest, fmt.Errorf("migrations: %w", err)
+	}
+	if manifest.SchemaVersion > latest {
+		return manifest, fmt.Errorf("schema version %d is newer than the latest supported version %d", manifest.SchemaVersion, latest)
+	}
+	for _, table := range backupTables {
+		if _, ok = files[table.name+".csv"]; !ok {
+			return manifest, fmt.Errorf("%s.csv not found", table.name)
+		}
+	}
+	return manifest, nil
+}
+
+// readPartitionMonths returns the covid19 partitions needed to restore the archived covid19 rows
+func readPartitionMonths(f *zip.File) (map[string]struct{}, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rc.Close() }()
+
+	cr := csv.NewReader(rc)
+	// skip the header. loadTable checks it
+	if _, err = cr.Read(); err != nil {
+		return nil, err
+	}
+	months := make(map[string]struct{})
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return months, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// rows without a timestamp go to the default partition
+		if record[0] == "" {
+			continue
+		}
+		timestamp, err := time.Parse(time.RFC3339Nano, record[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid time: %w", err)
+		}
+		months[partitionMonth(timestamp)] = struct{}{}
+	}
+}
+
+func loadTable(ctx context.Context, tx *sqlx.Tx, table backupTable, f *zip.File, rows int64) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rc.Close() }()
+
+	cr := csv.NewReader(rc)
+	cr.FieldsPerRecord = len(table.columns)
+	header, err := cr.Read()
+	if err != nil {
+		return err
+	}
+	for i, column := range table.columns {
+		if header[i] != column {
+			return fmt.Errorf("unexpected columns %v", header)
+		}
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table.name, table.columns...))
+	if err != nil {
+		return err
+	}
+	args := make([]any, len(table.columns))
+	var count int64
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// empty fields were NULL values
+		for i, value := range record {
+			args[i] = nil
+			if value != "" {
+				args[i] = value
+			}
+		}
+		if _, err = stmt.ExecContext(ctx, args...); err != nil {
+			return err
+		}
+		count++
+	}
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		return err
+	}
+	if err = stmt.Close(); err != nil {
+		return err
+	}
+	if count != rows {
+		return fmt.Errorf("archive holds %d rows, manifest lists %d", count, rows)
+	}
+	return nil
+}
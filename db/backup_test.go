@@ -0,0 +1,65 @@
+package db_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/clambin/covid19/db"
+	"github.com/clambin/covid19/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDB_BackupRestore(t *testing.T) {
+	ctx := context.Background()
+	// leave an empty database for the other tests
+	defer func() {
+		require.NoError(t, DB.MigrateDown(ctx, 0))
+		require.NoError(t, DB.MigrateUp(ctx))
+	}()
+
+	start := time.Date(2022, time.January, 31, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, covidStore.Add(ctx, []models.CountryEntry{
+		{Timestamp: start, Code: "AA", Name: "A", Confirmed: 1, Deaths: 2, Recovered: 3},
+		{Timestamp: start.Add(24 * time.Hour), Code: "AA", Name: "A", Confirmed: 4, Deaths: 5, Recovered: 6},
+		{Timestamp: start.Add(24 * time.Hour), Code: "BB", Name: "B, the other one", Confirmed: 7, Deaths: 8, Recovered: 9},
+	}))
+	require.NoError(t, popStore.Add(ctx, "AA", 2022, 1000))
+	require.NoError(t, popStore.Add(ctx, "BB", 2021, 2000))
+
+	entries, err := covidStore.GetAllForRange(ctx, start, start.Add(24*time.Hour))
+	require.NoError(t, err)
+	totals, err := covidStore.GetTotalsPerDay(ctx)
+	require.NoError(t, err)
+	population, err := popStore.ListByYear(ctx)
+	require.NoError(t, err)
+
+	var archive bytes.Buffer
+	manifest, err := DB.Backup(ctx, &archive)
+	require.NoError(t, err)
+	assert.Equal(t, db.BackupFormat, manifest.Format)
+	assert.Equal(t, map[string]int64{"covid19": 3, "population": 2}, manifest.Rows)
+
+	// only restores into an empty database
+	_, err = DB.Restore(ctx, bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	assert.ErrorIs(t, err, db.ErrNotEmpty)
+
+	require.NoError(t, DB.MigrateDown(ctx, 0))
+	restored, err := DB.Restore(ctx, bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	require.NoError(t, err)
+	assert.Equal(t, manifest.SchemaVersion, restored.SchemaVersion)
+
+	current, err := covidStore.GetAllForRange(ctx, start, start.Add(24*time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, current, 3)
+	assert.Equal(t, entries, current)
+
+	currentTotals, err := covidStore.GetTotalsPerDay(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, totals, currentTotals)
+
+	currentPopulation, err := popStore.ListByYear(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, population, currentPopulation)
+}
@@ -2,11 +2,16 @@ package db
 
 import (
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
 	"time"
+	_ "time/tzdata"
 )
 
 func TestTimestampClause(t *testing.T) {
+	brussels, err := time.LoadLocation("Europe/Brussels")
+	require.NoError(t, err)
+
 	testCases := []struct {
 		from     time.Time
 		to       time.Time
@@ -28,6 +33,16 @@ func TestTimestampClause(t *testing.T) {
 			to:       time.Date(2022, time.January, 21, 0, 0, 0, 0, time.UTC),
 			expected: `time >= '2022-01-21T00:00:00Z' AND time <= '2022-01-21T00:00:00Z'`,
 		},
+		{
+			from:     time.Date(2023, time.March, 26, 0, 0, 0, 0, brussels),
+			to:       time.Date(2023, time.March, 27, 0, 0, 0, 0, brussels),
+			expected: `time >= '2023-03-25T23:00:00Z' AND time <= '2023-03-26T22:00:00Z'`,
+		},
+		{
+			from:     time.Date(2023, time.October, 29, 0, 0, 0, 0, brussels),
+			to:       time.Date(2023, time.October, 30, 0, 0, 0, 0, brussels),
+			expected: `time >= '2023-10-28T22:00:00Z' AND time <= '2023-10-29T23:00:00Z'`,
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -35,3 +50,33 @@ func TestTimestampClause(t *testing.T) {
 		assert.Equal(t, testCase.expected, clause)
 	}
 }
+
+func TestDayClause(t *testing.T) {
+	testCases := []struct {
+		from     time.Time
+		to       time.Time
+		expected string
+	}{
+		{
+			expected: ``,
+		},
+		{
+			from:     time.Date(2022, time.January, 21, 12, 0, 0, 0, time.UTC),
+			expected: `day >= '2022-01-21'`,
+		},
+		{
+			to:       time.Date(2022, time.January, 21, 12, 0, 0, 0, time.UTC),
+			expected: `day <= '2022-01-21'`,
+		},
+		{
+			from:     time.Date(2022, time.January, 14, 0, 0, 0, 0, time.UTC),
+			to:       time.Date(2022, time.January, 21, 0, 0, 0, 0, time.UTC),
+			expected: `day >= '2022-01-14' AND day <= '2022-01-21'`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		clause := makeDayClause(testCase.from, testCase.to)
+		assert.Equal(t, testCase.expected, clause)
+	}
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"context"
+	"github.com/clambin/covid19/tracing"
+	"time"
+)
+
+// Compact downsamples the covid19 figures reported before the provided date, keeping only the last entry per country
+// per day. These are the entries the daily views are built from, so compacting doesn't change the daily figures.
+// It returns the number of deleted rows.
+func (store *PGCovidStore) Compact(ctx context.Context, before time.Time) (deleted int64, err error) {
+	ctx, span := store.DB.startSpan(ctx, "PGCovidStore.Compact")
+	defer func() { _ = tracing.End(span, err) }()
+
+	// the order must match the one used by covid19_daily to select the last entry per day. rows are identified by
+	// tableoid and ctid, as ctid is only unique within a partition.
+	result, err := store.DB.primaryHandle().ExecContext(ctx, `
+WITH ranked AS (
+    SELECT tableoid, ctid, ROW_NUMBER() OVER (
+        PARTITION BY country_name, report_date
+        ORDER BY time DESC, confirmed DESC, death DESC, recovered DESC, country_code
+    ) AS rank
+    FROM covid19
+    WHERE report_date < $1
+)
+DELETE FROM covid19 USING ranked
+WHERE covid19.tableoid = ranked.tableoid AND covid19.ctid = ranked.ctid AND ranked.rank > 1`,
+		before.UTC().Format("2006-01-02"),
+	)
+	if err != nil {
+		return 0, err
+	}
+	if deleted, err = result.RowsAffected(); err != nil || deleted == 0 {
+		return deleted, err
+	}
+	store.DB.refreshViews(ctx)
+	return deleted, nil
+}
@@ -0,0 +1,72 @@
+package db_test
+
+import (
+	"context"
+	"github.com/clambin/covid19/db"
+	"github.com/clambin/covid19/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCovidStore_Compact(t *testing.T) {
+	ctx := context.Background()
+	runStore := db.NewRunStore(DB)
+	id, err := runStore.StartRun(ctx, "covid", "")
+	require.NoError(t, err)
+
+	// several entries per day, including ties on time, across a month boundary
+	start := time.Date(2020, time.January, 30, 0, 0, 0, 0, time.UTC)
+	var entries []models.CountryEntry
+	for day := 0; day < 5; day++ {
+		for update := 0; update < 3; update++ {
+			timestamp := start.Add(time.Duration(day)*24*time.Hour + time.Duration(update%2)*time.Hour)
+			for _, name := range []string{"compact-A", "compact-B"} {
+				entries = append(entries, models.CountryEntry{
+					Timestamp: timestamp,
+					Code:      "!!",
+					Name:      name,
+					Confirmed: int64(10*day + update),
+					Deaths:    int64(day),
+					Recovered: int64(update),
+				})
+			}
+		}
+	}
+	require.NoError(t, covidStore.ForRun(id).Add(ctx, entries))
+	defer func() {
+		_, err := runStore.Rollback(ctx, id)
+		require.NoError(t, err)
+	}()
+
+	totals, err := covidStore.GetTotalsPerDay(ctx)
+	require.NoError(t, err)
+	daily, err := covidStore.GetDailyForCountryName(ctx, "compact-A")
+	require.NoError(t, err)
+	require.Len(t, daily, 5)
+	rows, err := covidStore.Rows(ctx)
+	require.NoError(t, err)
+
+	// compact the first three report dates
+	cutoff := start.Add(2 * 24 * time.Hour)
+	deleted, err := covidStore.Compact(ctx, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2*3*2), deleted)
+
+	current, err := covidStore.Rows(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, rows-int(deleted), current)
+
+	compacted, err := covidStore.GetTotalsPerDay(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, totals, compacted)
+	compactedDaily, err := covidStore.GetDailyForCountryName(ctx, "compact-A")
+	require.NoError(t, err)
+	assert.Equal(t, daily, compactedDaily)
+
+	// compacting again changes nothing
+	deleted, err = covidStore.Compact(ctx, cutoff)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+}
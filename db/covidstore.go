@@ -1,10 +1,13 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/clambin/covid19/models"
+	"github.com/clambin/covid19/tracing"
+	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 	"strings"
 	"time"
@@ -13,6 +16,8 @@ import (
 // PGCovidStore implements CovidStore for Postgres databases
 type PGCovidStore struct {
 	DB *DB
+	// runID is the loader run that adds rows through the store, if any
+	runID sql.NullInt64
 }
 
 // NewCovidStore creates a new PGCovidStore and initializes the database, if necessary
@@ -20,28 +25,40 @@ func NewCovidStore(db *DB) *PGCovidStore {
 	return &PGCovidStore{DB: db}
 }
 
+// ForRun returns a copy of the store that stamps the covid19 rows it adds with the id of a loader run
+func (store *PGCovidStore) ForRun(id int64) *PGCovidStore {
+	return &PGCovidStore{DB: store.DB, runID: sql.NullInt64{Int64: id, Valid: true}}
+}
+
 const (
-	queryStatement = `SELECT time "timestamp", country_code "code", country_name "name", confirmed, recovered, death "deaths" FROM covid19`
+	queryStatement           = `SELECT time "timestamp", report_date "reportdate", country_code "code", country_name "name", confirmed, recovered, death "deaths" FROM covid19`
+	dailyQueryStatement      = `SELECT day::TIMESTAMP "timestamp", country_code "code", country_name "name", confirmed, recovered, death "deaths", new_confirmed "newconfirmed", new_death "newdeaths", confirmed_avg7 "confirmedaverage", death_avg7 "deathsaverage" FROM covid19_daily`
+	worldDailyQueryStatement = `SELECT day::TIMESTAMP "timestamp", confirmed, recovered, death "deaths", new_confirmed "newconfirmed", new_death "newdeaths", confirmed_avg7 "confirmedaverage", death_avg7 "deathsaverage" FROM covid19_world_daily`
 )
 
 // GetAllForRange returns all entries in the database, sorted by timestamp
-func (store *PGCovidStore) GetAllForRange(from, to time.Time) ([]models.CountryEntry, error) {
+func (store *PGCovidStore) GetAllForRange(ctx context.Context, from, to time.Time) ([]models.CountryEntry, error) {
+	ctx, span := store.DB.startSpan(ctx, "PGCovidStore.GetAllForRange")
 	var countryEntries []models.CountryEntry
-	err := store.DB.Handle.Select(&countryEntries, queryStatement+` WHERE `+makeTimestampClause(from, to)+` ORDER BY 1`)
-	return countryEntries, err
+	err := store.DB.selectContext(ctx, &countryEntries, queryStatement+` WHERE `+makeTimestampClause(from, to)+` ORDER BY 1`)
+	return countryEntries, tracing.End(span, err)
 }
 
 // GetAllForCountryName returns all entries in the database, sorted by timestamp
-func (store *PGCovidStore) GetAllForCountryName(countryName string) ([]models.CountryEntry, error) {
+func (store *PGCovidStore) GetAllForCountryName(ctx context.Context, countryName string) ([]models.CountryEntry, error) {
+	ctx, span := store.DB.startSpan(ctx, "PGCovidStore.GetAllForCountryName")
 	var countryEntries []models.CountryEntry
-	err := store.DB.Handle.Select(&countryEntries, queryStatement+` WHERE country_name = '`+escapeString(countryName)+`' ORDER BY 1`)
-	return countryEntries, err
+	err := store.DB.selectContext(ctx, &countryEntries, queryStatement+` WHERE country_name = '`+escapeString(countryName)+`' ORDER BY 1`)
+	return countryEntries, tracing.End(span, err)
 }
 
 // GetLatestForCountries gets the last entries for each country up the specified endTime.
 // If endTime is time.Time{}, it will get the latest entries up to the current time.
-func (store *PGCovidStore) GetLatestForCountries(endTime time.Time) (map[string]models.CountryEntry, error) {
-	countryNames, err := store.GetAllCountryNames()
+func (store *PGCovidStore) GetLatestForCountries(ctx context.Context, endTime time.Time) (_ map[string]models.CountryEntry, err error) {
+	ctx, span := store.DB.startSpan(ctx, "PGCovidStore.GetLatestForCountries")
+	defer func() { _ = tracing.End(span, err) }()
+
+	countryNames, err := store.GetAllCountryNames(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -53,7 +70,7 @@ func (store *PGCovidStore) GetLatestForCountries(endTime time.Time) (map[string]
 	entries := make(map[string]models.CountryEntry)
 	for _, countryName := range countryNames {
 		var entry models.CountryEntry
-		entry, err = store.getLatestForCountry(countryName, endTime)
+		entry, err = store.getLatestForCountry(ctx, countryName, endTime)
 		if errors.Is(err, sql.ErrNoRows) {
 			continue
 		}
@@ -65,7 +82,7 @@ func (store *PGCovidStore) GetLatestForCountries(endTime time.Time) (map[string]
 	return entries, err
 }
 
-func (store *PGCovidStore) getLatestForCountry(countryName string, endTime time.Time) (models.CountryEntry, error) {
+func (store *PGCovidStore) getLatestForCountry(ctx context.Context, countryName string, endTime time.Time) (models.CountryEntry, error) {
 	timestampClause := makeTimestampClause(time.Time{}, endTime)
 	if timestampClause != "" {
 		timestampClause = " AND " + timestampClause
@@ -73,46 +90,97 @@ func (store *PGCovidStore) getLatestForCountry(countryName string, endTime time.
 	statement := queryStatement + ` WHERE country_name = '%s'` + timestampClause + ` ORDER BY 1 DESC`
 
 	var entry models.CountryEntry
-	err := store.DB.Handle.Get(&entry, fmt.Sprintf(statement, escapeString(countryName)))
+	err := store.DB.getContext(ctx, &entry, fmt.Sprintf(statement, escapeString(countryName)))
 	return entry, err
 }
 
-// Add inserts new entries in the database
-func (store *PGCovidStore) Add(entries []models.CountryEntry) error {
-	tx := store.DB.Handle.MustBegin()
+// Add inserts new entries in the database. If the store was created by ForRun, the entries are stamped with the run's id
+func (store *PGCovidStore) Add(ctx context.Context, entries []models.CountryEntry) (err error) {
+	ctx, span := store.DB.startSpan(ctx, "PGCovidStore.Add")
+	defer func() { _ = tracing.End(span, err) }()
+
+	tx, err := store.DB.primaryHandle().BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
 	defer func() {
 		// will be ignored if we commit before the function returns
 		_ = tx.Rollback()
 	}()
 
-	stmt, err := tx.Prepare(pq.CopyIn("covid19", "time", "country_code", "country_name", "confirmed", "death", "recovered"))
+	months := make(map[string]struct{})
+	for _, entry := range entries {
+		months[partitionMonth(entry.Timestamp)] = struct{}{}
+	}
+	if err = createPartitions(ctx, tx, months); err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("covid19", "time", "report_date", "country_code", "country_name", "confirmed", "death", "recovered", "run_id"))
 	if err != nil {
 		return err
 	}
 
 	for _, entry := range entries {
-		if _, err = stmt.Exec(entry.Timestamp, entry.Code, entry.Name, entry.Confirmed, entry.Deaths, entry.Recovered); err != nil {
+		// write timestamps in UTC and the report date as a plain date, so neither depends on the session's timezone
+		if _, err = stmt.ExecContext(ctx, entry.Timestamp.UTC(), entry.GetReportDate().Format("2006-01-02"), entry.Code, entry.Name, entry.Confirmed, entry.Deaths, entry.Recovered, store.runID); err != nil {
 			return err
 		}
 	}
 
-	if _, err = stmt.Exec(); err == nil {
-		err = tx.Commit()
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		return err
+	}
+	if err = stmt.Close(); err != nil {
+		return err
+	}
+	if store.runID.Valid {
+		if _, err = tx.ExecContext(ctx, `UPDATE ingestion_runs SET inserted = inserted + $2 WHERE id = $1`, store.runID, len(entries)); err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err == nil {
+		store.DB.refreshViews(ctx)
 	}
 	return err
 }
 
+// partitionMonth returns the first day of the month of the covid19 partition holding the timestamp
+func partitionMonth(timestamp time.Time) string {
+	return timestamp.UTC().Format("2006-01") + "-01"
+}
+
+// createPartitions creates the monthly partitions of the covid19 table, as returned by partitionMonth, if they don't exist yet
+func createPartitions(ctx context.Context, tx *sqlx.Tx, months map[string]struct{}) error {
+	for month := range months {
+		if _, err := tx.ExecContext(ctx, `SELECT covid19_create_partition($1::DATE)`, month); err != nil {
+			return fmt.Errorf("create partition for %s: %w", month, err)
+		}
+	}
+	return nil
+}
+
 // Rows returns the number of rows in the store
-func (store *PGCovidStore) Rows() (int, error) {
+func (store *PGCovidStore) Rows(ctx context.Context) (int, error) {
+	ctx, span := store.DB.startSpan(ctx, "PGCovidStore.Rows")
 	var rows int
-	err := store.DB.Handle.Get(&rows, `SELECT COUNT(*) AS rows FROM covid19`)
-	return rows, err
+	err := store.DB.getContext(ctx, &rows, `SELECT COUNT(*) AS rows FROM covid19`)
+	return rows, tracing.End(span, err)
+}
+
+// GetLatestTimestamp returns the most recent timestamp in the store. If the store is empty, it returns time.Time{}
+func (store *PGCovidStore) GetLatestTimestamp(ctx context.Context) (time.Time, error) {
+	ctx, span := store.DB.startSpan(ctx, "PGCovidStore.GetLatestTimestamp")
+	var timestamp sql.NullTime
+	err := store.DB.getContext(ctx, &timestamp, `SELECT MAX(time) FROM covid19`)
+	return timestamp.Time, tracing.End(span, err)
 }
 
 // GetAllCountryNames gets all unique country names from the database
-func (store *PGCovidStore) GetAllCountryNames() (names []string, err error) {
-	err = store.DB.Handle.Select(&names, `SELECT DISTINCT country_name FROM covid19 ORDER BY 1`)
-	return names, err
+func (store *PGCovidStore) GetAllCountryNames(ctx context.Context) (names []string, err error) {
+	ctx, span := store.DB.startSpan(ctx, "PGCovidStore.GetAllCountryNames")
+	err = store.DB.selectContext(ctx, &names, `SELECT DISTINCT country_name FROM covid19 ORDER BY 1`)
+	return names, tracing.End(span, err)
 }
 
 type TimestampCount struct {
@@ -121,31 +189,67 @@ type TimestampCount struct {
 }
 
 // CountEntriesByTime counts updates per timestamp
-func (store *PGCovidStore) CountEntriesByTime(from, to time.Time) ([]TimestampCount, error) {
+func (store *PGCovidStore) CountEntriesByTime(ctx context.Context, from, to time.Time) ([]TimestampCount, error) {
+	ctx, span := store.DB.startSpan(ctx, "PGCovidStore.CountEntriesByTime")
 	var updates []TimestampCount
 	whereClause := makeTimestampClause(from, to)
 	if whereClause != "" {
 		whereClause = " WHERE " + whereClause
 	}
 
-	err := store.DB.Handle.Select(&updates, `SELECT time AS "timestamp", COUNT(*) "count" FROM covid19 `+whereClause+` GROUP BY time ORDER BY time`)
-	return updates, err
+	err := store.DB.selectContext(ctx, &updates, `SELECT time AS "timestamp", COUNT(*) "count" FROM covid19 `+whereClause+` GROUP BY time ORDER BY time`)
+	return updates, tracing.End(span, err)
 }
 
-// GetTotalsPerDay returns the total new cases per day across all countries
-func (store *PGCovidStore) GetTotalsPerDay() ([]models.CountryEntry, error) {
-	var entries []models.CountryEntry
-	err := store.DB.Handle.Select(&entries, `SELECT time AS "timestamp", SUM(confirmed) AS "confirmed", SUM(death) AS "deaths" FROM covid19 GROUP BY time ORDER BY time`)
-	return entries, err
+// GetTotalsPerDay returns the total cases per day across all countries
+func (store *PGCovidStore) GetTotalsPerDay(ctx context.Context) ([]models.DailyEntry, error) {
+	ctx, span := store.DB.startSpan(ctx, "PGCovidStore.GetTotalsPerDay")
+	var entries []models.DailyEntry
+	err := store.DB.selectContext(ctx, &entries, worldDailyQueryStatement+` ORDER BY 1`)
+	return entries, tracing.End(span, err)
+}
+
+// GetDailyForCountryName returns the daily figures for a country, sorted by timestamp
+func (store *PGCovidStore) GetDailyForCountryName(ctx context.Context, countryName string) ([]models.DailyEntry, error) {
+	ctx, span := store.DB.startSpan(ctx, "PGCovidStore.GetDailyForCountryName")
+	var entries []models.DailyEntry
+	err := store.DB.selectContext(ctx, &entries, dailyQueryStatement+` WHERE country_name = '`+escapeString(countryName)+`' ORDER BY 1`)
+	return entries, tracing.End(span, err)
+}
+
+// GetDailyForRange returns the daily figures for all countries for the report dates in the specified range, sorted by timestamp
+func (store *PGCovidStore) GetDailyForRange(ctx context.Context, from, to time.Time) ([]models.DailyEntry, error) {
+	ctx, span := store.DB.startSpan(ctx, "PGCovidStore.GetDailyForRange")
+	whereClause := makeDayClause(from, to)
+	if whereClause != "" {
+		whereClause = " WHERE " + whereClause
+	}
+	var entries []models.DailyEntry
+	err := store.DB.selectContext(ctx, &entries, dailyQueryStatement+whereClause+` ORDER BY 1, 3`)
+	return entries, tracing.End(span, err)
 }
 
 func makeTimestampClause(from, to time.Time) (clause string) {
 	var conditions []string
 	if !from.IsZero() {
-		conditions = append(conditions, fmt.Sprintf("time >= '%s'", from.Format(time.RFC3339)))
+		conditions = append(conditions, fmt.Sprintf("time >= '%s'", from.UTC().Format(time.RFC3339)))
+	}
+	if !to.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("time <= '%s'", to.UTC().Format(time.RFC3339)))
+	}
+	if len(conditions) > 0 {
+		clause = strings.Join(conditions, " AND ")
+	}
+	return
+}
+
+func makeDayClause(from, to time.Time) (clause string) {
+	var conditions []string
+	if !from.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("day >= '%s'", from.UTC().Format("2006-01-02")))
 	}
 	if !to.IsZero() {
-		conditions = append(conditions, fmt.Sprintf("time <= '%s'", to.Format(time.RFC3339)))
+		conditions = append(conditions, fmt.Sprintf("day <= '%s'", to.UTC().Format("2006-01-02")))
 	}
 	if len(conditions) > 0 {
 		clause = strings.Join(conditions, " AND ")
@@ -1,6 +1,7 @@
 package db_test
 
 import (
+	"context"
 	"github.com/clambin/covid19/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -36,25 +37,34 @@ func TestCovidStore(t *testing.T) {
 	)
 
 	end := time.Date(2023, time.March, 21, 0, 0, 0, 0, time.UTC)
-	entries, err := covidStore.GetAllForRange(end.Add(-7*24*time.Hour), end)
+	entries, err := covidStore.GetAllForRange(context.Background(), end.Add(-7*24*time.Hour), end)
 	require.NoError(t, err)
 	assert.Len(t, entries, 0)
 
-	rows, err = covidStore.Rows()
+	rows, err = covidStore.Rows(context.Background())
 	require.NoError(t, err)
 	assert.Zero(t, rows)
 
-	err = covidStore.Add(newEntries)
+	newest, err := covidStore.GetLatestTimestamp(context.Background())
 	require.NoError(t, err)
+	assert.True(t, newest.IsZero())
 
-	rows, err = covidStore.Rows()
+	err = covidStore.Add(context.Background(), newEntries)
+	require.NoError(t, err)
+
+	rows, err = covidStore.Rows(context.Background())
 	require.NoError(t, err)
 	assert.Equal(t, 2, rows)
 
-	entries, err = covidStore.GetAllForRange(first, last)
+	newest, err = covidStore.GetLatestTimestamp(context.Background())
+	require.NoError(t, err)
+	assert.True(t, newest.Equal(last))
+
+	entries, err = covidStore.GetAllForRange(context.Background(), first, last)
 	require.NoError(t, err)
 	require.Len(t, entries, 2)
 	assert.True(t, entries[0].Timestamp.Equal(first))
+	assert.True(t, entries[0].ReportDate.Equal(time.Date(2021, 12, 14, 0, 0, 0, 0, time.UTC)))
 	assert.Equal(t, int64(3), entries[0].Confirmed)
 	assert.Equal(t, int64(2), entries[0].Deaths)
 	assert.Equal(t, int64(1), entries[0].Recovered)
@@ -63,23 +73,23 @@ func TestCovidStore(t *testing.T) {
 	assert.Equal(t, int64(5), entries[1].Deaths)
 	assert.Equal(t, int64(4), entries[1].Recovered)
 
-	entries, err = covidStore.GetAllForRange(first, first)
+	entries, err = covidStore.GetAllForRange(context.Background(), first, first)
 	require.NoError(t, err)
 	require.Len(t, entries, 1)
 	assert.True(t, entries[0].Timestamp.Equal(first))
 
-	entries, err = covidStore.GetAllForCountryName("???")
+	entries, err = covidStore.GetAllForCountryName(context.Background(), "???")
 	require.NoError(t, err)
 	assert.Len(t, entries, 2)
 
 	var countryNames []string
-	countryNames, err = covidStore.GetAllCountryNames()
+	countryNames, err = covidStore.GetAllCountryNames(context.Background())
 	require.NoError(t, err)
 	require.Len(t, countryNames, 1)
 	assert.Equal(t, "???", countryNames[0])
 
 	var latest map[string]models.CountryEntry
-	latest, err = covidStore.GetLatestForCountries(time.Time{})
+	latest, err = covidStore.GetLatestForCountries(context.Background(), time.Time{})
 	require.NoError(t, err)
 	entry, found := latest["???"]
 	require.True(t, found)
@@ -88,7 +98,7 @@ func TestCovidStore(t *testing.T) {
 	assert.Equal(t, int64(5), entry.Deaths)
 	assert.Equal(t, int64(4), entry.Recovered)
 
-	latest, err = covidStore.GetLatestForCountries(first)
+	latest, err = covidStore.GetLatestForCountries(context.Background(), first)
 	require.NoError(t, err)
 	entry, found = latest["???"]
 	require.True(t, found)
@@ -97,7 +107,7 @@ func TestCovidStore(t *testing.T) {
 	assert.Equal(t, int64(2), entry.Deaths)
 	assert.Equal(t, int64(1), entry.Recovered)
 
-	updates, err := covidStore.CountEntriesByTime(first, last)
+	updates, err := covidStore.CountEntriesByTime(context.Background(), first, last)
 	require.NoError(t, err)
 	require.Len(t, updates, 2)
 	assert.True(t, updates[0].Timestamp.Equal(first))
@@ -105,11 +115,44 @@ func TestCovidStore(t *testing.T) {
 	assert.True(t, updates[1].Timestamp.Equal(last))
 	assert.Equal(t, 1, updates[1].Count)
 
-	totals, err := covidStore.GetTotalsPerDay()
+	totals, err := covidStore.GetTotalsPerDay(context.Background())
 	require.NoError(t, err)
 	require.Len(t, totals, 2)
 	assert.Equal(t, int64(3), totals[0].Confirmed)
 	assert.Equal(t, int64(2), totals[0].Deaths)
+	assert.Equal(t, int64(3), totals[0].NewConfirmed)
 	assert.Equal(t, int64(6), totals[1].Confirmed)
 	assert.Equal(t, int64(5), totals[1].Deaths)
+	assert.Equal(t, int64(3), totals[1].NewConfirmed)
+	assert.Equal(t, int64(3), totals[1].NewDeaths)
+	assert.Equal(t, 3.0, totals[1].ConfirmedAverage)
+
+	daily, err := covidStore.GetDailyForCountryName(context.Background(), "???")
+	require.NoError(t, err)
+	require.Len(t, daily, 2)
+	assert.True(t, daily[0].Timestamp.Equal(models.ReportDate(first)))
+	assert.Equal(t, "??", daily[0].Code)
+	assert.Equal(t, int64(3), daily[0].NewConfirmed)
+	assert.Zero(t, daily[0].ConfirmedAverage)
+	assert.True(t, daily[1].Timestamp.Equal(models.ReportDate(last)))
+	assert.Equal(t, int64(3), daily[1].NewConfirmed)
+	assert.Equal(t, int64(3), daily[1].NewDeaths)
+	assert.Equal(t, 3.0, daily[1].ConfirmedAverage)
+	assert.Equal(t, 3.0, daily[1].DeathsAverage)
+
+	daily, err = covidStore.GetDailyForRange(context.Background(), models.ReportDate(last), models.ReportDate(last))
+	require.NoError(t, err)
+	require.Len(t, daily, 1)
+	assert.Equal(t, "???", daily[0].Name)
+	assert.Equal(t, int64(6), daily[0].Confirmed)
+}
+
+func TestCovidStore_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := covidStore.GetAllForRange(ctx, time.Time{}, time.Time{})
+	assert.ErrorIs(t, err, context.Canceled)
+	err = covidStore.Add(ctx, []models.CountryEntry{{Timestamp: time.Now(), Code: "??", Name: "???"}})
+	assert.ErrorIs(t, err, context.Canceled)
 }
@@ -1,84 +1,319 @@
 package db
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"embed"
 	"errors"
 	"fmt"
 	"github.com/clambin/covid19/configuration"
+	"github.com/clambin/covid19/pkg/retry"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
-	// postgres sql driver
-	_ "github.com/lib/pq"
+	"golang.org/x/exp/slog"
+	"io"
+	"io/fs"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 // DB hold the handle to a database.  Provides a Prometheus DBStatsCollector to monitor DB connections
 type DB struct {
-	Collector prometheus.Collector
-	database  string
-	Handle    *sqlx.DB
+	Collector   prometheus.Collector
+	database    string
+	lockTimeout time.Duration
+	Handle      *sqlx.DB
+	// replica is set if Handle is a read replica
+	replica *replica
 }
 
-// New creates a new DB connector
+// New creates a new DB connector. If the database can't be reached, the connection is retried cfg.ConnectRetries times.
+// If cfg.AutoMigrate is set, any pending migrations are applied.
 func New(cfg configuration.PostgresDB) (*DB, error) {
-	dbh, err := sqlx.Connect("postgres", fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Database))
+	var dbh *sqlx.DB
+	r := retry.Retry{
+		BackOff:     retry.NewDoublerBackoff(cfg.ConnectRetries, connectRetryDelay, maxConnectRetryDelay),
+		ShouldRetry: isTransient,
+	}
+	err := r.Do(func() error {
+		var err error
+		if dbh, err = sqlx.Connect("postgres", dataSourceName(cfg)); err != nil {
+			slog.Warn("failed to connect to database", "err", err, "host", cfg.Host)
+		}
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("connect: %w", err)
 	}
 
+	dbh.SetMaxOpenConns(cfg.MaxOpenConns)
+	if cfg.MaxIdleConns > 0 {
+		dbh.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	dbh.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
 	db := &DB{
-		Handle:    dbh,
-		database:  cfg.Database,
-		Collector: collectors.NewDBStatsCollector(dbh.DB, cfg.Database),
+		Handle:      dbh,
+		database:    cfg.Database,
+		lockTimeout: cfg.MigrationLockTimeout,
+		Collector:   collectors.NewDBStatsCollector(dbh.DB, cfg.Database),
 	}
 
-	if err = db.migrate(); err != nil {
-		return nil, fmt.Errorf("migrate: %w", err)
+	if cfg.AutoMigrate {
+		if err = db.MigrateUp(context.Background()); err != nil {
+			return nil, fmt.Errorf("migrate: %w", err)
+		}
 	}
 
 	return db, err
 }
 
-func (db *DB) migrate() error {
-	migration, err := db.prepareMigration()
+const (
+	connectRetryDelay    = time.Second
+	maxConnectRetryDelay = 30 * time.Second
+)
+
+// isTransient returns true if connecting to the database may succeed later, e.g. because the server is still starting
+// or can't be reached yet. All other errors, like authentication failures, invalid TLS settings or certificates that
+// can't be verified, are permanent.
+func isTransient(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// class 57: operator intervention, e.g. 57P03 "the database system is starting up"
+		// class 08: connection exception
+		return pqErr.Code.Class() == "57" || pqErr.Code.Class() == "08"
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// dataSourceName returns the libpq connection string for the configuration
+func dataSourceName(cfg configuration.PostgresDB) string {
+	sslMode := cfg.SSLMode
+	if sslMode == "" {
+		sslMode = configuration.SSLModeDisable
+	}
+	params := [][2]string{
+		{"host", cfg.Host},
+		{"port", strconv.Itoa(cfg.Port)},
+		{"user", cfg.User},
+		{"password", cfg.Password},
+		{"dbname", cfg.Database},
+		{"sslmode", sslMode},
+		{"sslrootcert", cfg.SSLRootCert},
+		{"sslcert", cfg.SSLCert},
+		{"sslkey", cfg.SSLKey},
+		{"application_name", cfg.ApplicationName},
+	}
+	if cfg.ConnectTimeout > 0 {
+		// libpq only supports whole seconds
+		params = append(params, [2]string{"connect_timeout", strconv.Itoa(int(math.Ceil(cfg.ConnectTimeout.Seconds())))})
+	}
+
+	var parts []string
+	for _, param := range params {
+		if param[1] != "" {
+			parts = append(parts, param[0]+"="+quoteParameter(param[1]))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteParameter quotes a value of a connection string, so it may contain spaces and quotes
+func quoteParameter(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// Ready checks that the database can be reached and that all migrations have been applied
+func (db *DB) Ready(ctx context.Context) error {
+	var schema struct {
+		Version uint
+		Dirty   bool
+	}
+	if err := db.getContext(ctx, &schema, `SELECT version, dirty FROM schema_migrations`); err != nil {
+		return fmt.Errorf("schema version: %w", err)
+	}
+	latest, err := latestMigration()
 	if err != nil {
-		return fmt.Errorf("prepare migration: %w", err)
+		return fmt.Errorf("migrations: %w", err)
 	}
-	if err = migration.Up(); errors.Is(err, migrate.ErrNoChange) {
+	if schema.Dirty {
+		return fmt.Errorf("migration %d failed", schema.Version)
+	}
+	if schema.Version < latest {
+		return fmt.Errorf("migrations pending: schema version is %d, latest version is %d", schema.Version, latest)
+	}
+	return nil
+}
+
+// latestMigration returns the version of the most recent embedded migration
+func latestMigration() (uint, error) {
+	src, err := iofs.New(migrations, "migrations")
+	if err != nil {
+		return 0, fmt.Errorf("iofs: %w", err)
+	}
+	version, err := src.First()
+	for err == nil {
+		var next uint
+		if next, err = src.Next(version); err == nil {
+			version = next
+		}
+	}
+	if errors.Is(err, fs.ErrNotExist) {
 		err = nil
 	}
+	return version, err
+}
 
-	return err
+// refreshViews updates the daily aggregates after covid19 rows have been added or deleted. It runs after the changes are
+// committed, so a failure is logged rather than returned: callers would report a failed update and retry it, adding the
+// rows again. The views catch up with the next refresh.
+func (db *DB) refreshViews(ctx context.Context) {
+	for _, view := range []string{"covid19_daily", "covid19_world_daily"} {
+		if _, err := db.primaryHandle().ExecContext(ctx, `REFRESH MATERIALIZED VIEW CONCURRENTLY `+view); err != nil {
+			slog.Warn("failed to refresh view", "err", err, "view", view)
+		}
+	}
 }
 
 // RemoveAll deletes all database tables
 func (db *DB) RemoveAll() error {
-	migration, err := db.prepareMigration()
+	return db.MigrateDown(context.Background(), 0)
+}
+
+//go:embed migrations/*
+var migrations embed.FS
+
+// ErrMigrationLocked indicates that the migration lock couldn't be acquired within the configured timeout
+var ErrMigrationLocked = errors.New("migration lock timeout: another instance may be migrating the database")
+
+// runMigration runs a migration. If the context is canceled, it stops after the current migration step
+func (db *DB) runMigration(ctx context.Context, f func(*migrate.Migrate) error) (err error) {
+	migration, conn, err := db.prepareMigration(ctx)
 	if err != nil {
 		return fmt.Errorf("prepare migration: %w", err)
 	}
-	return migration.Down()
+	defer func() {
+		if errors.Is(err, ErrMigrationLocked) {
+			// if golang-migrate gave up before Postgres did, the lock may have been granted in the meantime:
+			// end the session, so the lock isn't held by a connection in the pool
+			discardConn(conn)
+		}
+		_, _ = migration.Close()
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			migration.GracefulStop <- true
+		case <-done:
+		}
+	}()
+
+	err = f(migration)
+	switch {
+	case errors.Is(err, migrate.ErrNoChange):
+		err = nil
+	case errors.Is(err, migrate.ErrLockTimeout):
+		err = ErrMigrationLocked
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
 }
 
-//go:embed migrations/*
-var migrations embed.FS
+// lockTimeoutMargin gives Postgres time to cancel the lock request, before golang-migrate stops waiting for it
+const lockTimeoutMargin = 5 * time.Second
 
-func (db *DB) prepareMigration() (*migrate.Migrate, error) {
+// prepareMigration creates a migration on a dedicated connection. Close the migration to release the connection
+func (db *DB) prepareMigration(ctx context.Context) (*migrate.Migrate, *sql.Conn, error) {
 	src, err := iofs.New(migrations, "migrations")
 	if err != nil {
-		return nil, fmt.Errorf("iofs: %w", err)
+		return nil, nil, fmt.Errorf("iofs: %w", err)
 	}
 
+	conn, err := db.primaryHandle().Conn(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("db: %w", err)
+	}
 	var dbDriver database.Driver
-	dbDriver, err = postgres.WithInstance(db.Handle.DB, &postgres.Config{DatabaseName: db.database})
+	if dbDriver, err = postgres.WithConnection(ctx, conn, &postgres.Config{DatabaseName: db.database}); err != nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("db: %w", err)
+	}
+	lockTimeout := db.lockTimeout
+	if lockTimeout <= 0 {
+		lockTimeout = migrate.DefaultLockTimeout
+	}
+	dbDriver = &lockTimeoutDriver{Driver: dbDriver, conn: conn, timeout: lockTimeout}
+
+	migration, err := migrate.NewWithInstance("migrations", src, db.database, dbDriver)
 	if err != nil {
-		return nil, fmt.Errorf("db: %w", err)
+		_ = dbDriver.Close()
+		return nil, nil, err
+	}
+	migration.LockTimeout = lockTimeout + lockTimeoutMargin
+	return migration, conn, nil
+}
+
+// lockTimeoutDriver has Postgres cancel the request for the migration lock after timeout. When golang-migrate stops
+// waiting for the lock, it leaves the pg_advisory_lock query running: the lock could then be granted later and held
+// for the life of the connection, blocking the migrations of all other instances.
+type lockTimeoutDriver struct {
+	database.Driver
+	conn    *sql.Conn
+	timeout time.Duration
+}
+
+// Lock acquires the migration lock. If Postgres cancels the request, Lock returns migrate.ErrLockTimeout
+func (d *lockTimeoutDriver) Lock() error {
+	ctx := context.Background()
+	if _, err := d.conn.ExecContext(ctx, `SELECT set_config('lock_timeout', $1, false)`, strconv.FormatInt(d.timeout.Milliseconds(), 10)); err != nil {
+		return fmt.Errorf("set lock_timeout: %w", err)
 	}
+	err := d.Driver.Lock()
+	if isLockNotAvailable(err) {
+		err = migrate.ErrLockTimeout
+	}
+	// the migrations themselves shouldn't time out waiting for locks
+	if _, resetErr := d.conn.ExecContext(ctx, `RESET lock_timeout`); resetErr != nil && err == nil {
+		_ = d.Driver.Unlock()
+		err = fmt.Errorf("reset lock_timeout: %w", resetErr)
+	}
+	return err
+}
+
+// isLockNotAvailable returns true if the postgres driver failed to acquire the lock within lock_timeout
+func isLockNotAvailable(err error) bool {
+	// database.Error doesn't implement Unwrap
+	var dbErr *database.Error
+	if !errors.As(err, &dbErr) {
+		return false
+	}
+	var pqErr *pq.Error
+	// 55P03: lock_not_available
+	return errors.As(dbErr.OrigErr, &pqErr) && pqErr.Code == "55P03"
+}
 
-	return migrate.NewWithInstance("migrations", src, db.database, dbDriver)
+// discardConn closes the connection's session, rather than returning the connection to the pool. It waits for any
+// running query to finish.
+func discardConn(conn *sql.Conn) {
+	_ = conn.Raw(func(any) error { return driver.ErrBadConn })
 }
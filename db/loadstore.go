@@ -0,0 +1,47 @@
+package db
+
+import (
+	"context"
+	"github.com/clambin/covid19/tracing"
+	"time"
+)
+
+// PGLoadStore records the time of the last successful load of each data source
+type PGLoadStore struct {
+	DB *DB
+}
+
+// NewLoadStore creates a new PGLoadStore
+func NewLoadStore(db *DB) *PGLoadStore {
+	return &PGLoadStore{DB: db}
+}
+
+// GetLastLoads returns the time of the last successful load for each data source
+func (store *PGLoadStore) GetLastLoads(ctx context.Context) (_ map[string]time.Time, err error) {
+	ctx, span := store.DB.startSpan(ctx, "PGLoadStore.GetLastLoads")
+	defer func() { _ = tracing.End(span, err) }()
+
+	var rows []struct {
+		Source string
+		Time   time.Time
+	}
+	if err = store.DB.selectContext(ctx, &rows, `SELECT source, time FROM loads`); err != nil {
+		return nil, err
+	}
+
+	loads := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		loads[row.Source] = row.Time
+	}
+	return loads, nil
+}
+
+// SetLastLoad records the time of the last successful load of a data source
+func (store *PGLoadStore) SetLastLoad(ctx context.Context, source string, timestamp time.Time) error {
+	ctx, span := store.DB.startSpan(ctx, "PGLoadStore.SetLastLoad")
+	_, err := store.DB.primaryHandle().ExecContext(ctx,
+		`INSERT INTO loads(source, time) VALUES ($1, $2) ON CONFLICT (source) DO UPDATE SET time = EXCLUDED.time`,
+		source, timestamp.UTC(),
+	)
+	return tracing.End(span, err)
+}
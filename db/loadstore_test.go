@@ -0,0 +1,34 @@
+package db_test
+
+import (
+	"context"
+	"github.com/clambin/covid19/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLoadStore(t *testing.T) {
+	store := db.NewLoadStore(DB)
+	ctx := context.Background()
+
+	loads, err := store.GetLastLoads(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, loads)
+
+	timestamp := time.Date(2023, time.March, 22, 6, 0, 0, 0, time.UTC)
+	require.NoError(t, store.SetLastLoad(ctx, "covid", timestamp))
+	require.NoError(t, store.SetLastLoad(ctx, "covid", timestamp.Add(time.Hour)))
+	require.NoError(t, store.SetLastLoad(ctx, "population", timestamp))
+
+	loads, err = store.GetLastLoads(ctx)
+	require.NoError(t, err)
+	require.Len(t, loads, 2)
+	assert.True(t, loads["covid"].Equal(timestamp.Add(time.Hour)))
+	assert.True(t, loads["population"].Equal(timestamp))
+}
+
+func TestDB_Ready(t *testing.T) {
+	assert.NoError(t, DB.Ready(context.Background()))
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// MigrateUp applies all pending migrations
+func (db *DB) MigrateUp(ctx context.Context) error {
+	return db.runMigration(ctx, func(m *migrate.Migrate) error {
+		return m.Up()
+	})
+}
+
+// MigrateDown rolls back the provided number of migrations. If steps is zero, all migrations are rolled back,
+// deleting all tables
+func (db *DB) MigrateDown(ctx context.Context, steps uint) error {
+	return db.runMigration(ctx, func(m *migrate.Migrate) error {
+		if steps == 0 {
+			return m.Down()
+		}
+		return m.Steps(-int(steps))
+	})
+}
+
+// MigrateTo applies or rolls back migrations until the schema is at the provided version. Version zero rolls back
+// all migrations
+func (db *DB) MigrateTo(ctx context.Context, version uint) error {
+	latest, err := latestMigration()
+	if err != nil {
+		return fmt.Errorf("migrations: %w", err)
+	}
+	if version > latest {
+		return fmt.Errorf("invalid version %d: latest version is %d", version, latest)
+	}
+	return db.runMigration(ctx, func(m *migrate.Migrate) error {
+		if version == 0 {
+			return m.Down()
+		}
+		return m.Migrate(version)
+	})
+}
+
+// MigrationStatus is the state of the database schema
+type MigrationStatus struct {
+	// Version is the last applied migration. Zero if no migrations have been applied
+	Version uint
+	// Dirty indicates that the last migration failed and needs to be repaired manually
+	Dirty bool
+	// Latest is the version of the most recent migration
+	Latest uint
+}
+
+// Pending returns the number of migrations that haven't been applied yet
+func (s MigrationStatus) Pending() uint {
+	if s.Version >= s.Latest {
+		return 0
+	}
+	return s.Latest - s.Version
+}
+
+// MigrationStatus returns the state of the database schema
+func (db *DB) MigrationStatus(ctx context.Context) (status MigrationStatus, err error) {
+	if status.Latest, err = latestMigration(); err != nil {
+		return status, fmt.Errorf("migrations: %w", err)
+	}
+	migration, _, err := db.prepareMigration(ctx)
+	if err != nil {
+		return status, fmt.Errorf("prepare migration: %w", err)
+	}
+	defer func() { _, _ = migration.Close() }()
+	status.Version, status.Dirty, err = migration.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		err = nil
+	}
+	return status, err
+}
@@ -0,0 +1,69 @@
+package db_test
+
+import (
+	"context"
+	"github.com/clambin/covid19/db"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDB_Migrate(t *testing.T) {
+	ctx := context.Background()
+
+	status, err := DB.MigrationStatus(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, status.Latest, status.Version)
+	assert.False(t, status.Dirty)
+	assert.Zero(t, status.Pending())
+
+	require.NoError(t, DB.MigrateDown(ctx, 1))
+	status, err = DB.MigrationStatus(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, status.Latest-1, status.Version)
+	assert.Equal(t, uint(1), status.Pending())
+	assert.Error(t, DB.Ready(ctx))
+
+	require.NoError(t, DB.MigrateTo(ctx, status.Latest))
+	assert.NoError(t, DB.Ready(ctx))
+	assert.Error(t, DB.MigrateTo(ctx, status.Latest+1))
+
+	require.NoError(t, DB.MigrateUp(ctx))
+}
+
+func TestDB_MigrateUp_LockTimeout(t *testing.T) {
+	ctx := context.Background()
+	cfg := pgConfig
+	cfg.AutoMigrate = false
+	cfg.MigrationLockTimeout = 500 * time.Millisecond
+	other, err := db.New(cfg)
+	require.NoError(t, err)
+	defer func() { _ = other.Handle.Close() }()
+
+	// hold the migration lock, as an instance that is migrating the database would
+	conn, err := DB.Handle.Conn(ctx)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	var schema string
+	require.NoError(t, conn.QueryRowContext(ctx, `SELECT current_schema()`).Scan(&schema))
+	lockID, err := database.GenerateAdvisoryLockId(cfg.Database, schema, "schema_migrations")
+	require.NoError(t, err)
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, other.MigrateUp(ctx), db.ErrMigrationLocked)
+
+	// once the lock is released, no timed out lock request holds on to it
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, lockID)
+	require.NoError(t, err)
+	assert.NoError(t, other.MigrateUp(ctx))
+	assert.NoError(t, DB.MigrateUp(ctx))
+}
+
+func TestMigrationStatus_Pending(t *testing.T) {
+	assert.Equal(t, uint(3), db.MigrationStatus{Version: 5, Latest: 8}.Pending())
+	assert.Zero(t, db.MigrationStatus{Version: 8, Latest: 8}.Pending())
+	assert.Zero(t, db.MigrationStatus{Version: 9, Latest: 8}.Pending())
+}
@@ -0,0 +1,2 @@
+DROP MATERIALIZED VIEW IF EXISTS covid19_world_daily;
+DROP MATERIALIZED VIEW IF EXISTS covid19_daily;
@@ -0,0 +1,46 @@
+DROP MATERIALIZED VIEW IF EXISTS covid19_world_daily;
+DROP MATERIALIZED VIEW IF EXISTS covid19_daily;
+
+ALTER TABLE covid19 ALTER COLUMN time TYPE TIMESTAMP WITH TIME ZONE USING time AT TIME ZONE 'UTC';
+ALTER TABLE covid19 ADD COLUMN IF NOT EXISTS report_date DATE;
+UPDATE covid19 SET report_date = ((time AT TIME ZONE 'UTC') - INTERVAL '1 day')::DATE WHERE report_date IS NULL;
+ALTER TABLE covid19 ALTER COLUMN report_date SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_covid_report_date ON covid19(report_date);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS covid19_daily AS
+WITH last_per_day AS (
+    SELECT DISTINCT ON (country_name, report_date)
+        report_date AS day, country_code, country_name, confirmed, death, recovered
+    FROM covid19
+    ORDER BY country_name, report_date, time DESC
+)
+SELECT
+    day, country_code, country_name, confirmed, death, recovered,
+    confirmed - LAG(confirmed, 1, 0::BIGINT) OVER w AS new_confirmed,
+    death - LAG(death, 1, 0::BIGINT) OVER w AS new_death,
+    COALESCE((confirmed - FIRST_VALUE(confirmed) OVER w7)::DOUBLE PRECISION / NULLIF(day - FIRST_VALUE(day) OVER w7, 0), 0) AS confirmed_avg7,
+    COALESCE((death - FIRST_VALUE(death) OVER w7)::DOUBLE PRECISION / NULLIF(day - FIRST_VALUE(day) OVER w7, 0), 0) AS death_avg7
+FROM last_per_day
+WINDOW
+    w AS (PARTITION BY country_name ORDER BY day),
+    w7 AS (PARTITION BY country_name ORDER BY day RANGE BETWEEN INTERVAL '7 days' PRECEDING AND CURRENT ROW);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_covid_daily_country_name_day ON covid19_daily(country_name, day);
+CREATE INDEX IF NOT EXISTS idx_covid_daily_day ON covid19_daily(day);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS covid19_world_daily AS
+WITH totals AS (
+    SELECT day, SUM(confirmed)::BIGINT AS confirmed, SUM(death)::BIGINT AS death, SUM(recovered)::BIGINT AS recovered
+    FROM covid19_daily
+    GROUP BY day
+)
+SELECT
+    day, confirmed, death, recovered,
+    confirmed - LAG(confirmed, 1, 0::BIGINT) OVER w AS new_confirmed,
+    death - LAG(death, 1, 0::BIGINT) OVER w AS new_death,
+    COALESCE((confirmed - FIRST_VALUE(confirmed) OVER w7)::DOUBLE PRECISION / NULLIF(day - FIRST_VALUE(day) OVER w7, 0), 0) AS confirmed_avg7,
+    COALESCE((death - FIRST_VALUE(death) OVER w7)::DOUBLE PRECISION / NULLIF(day - FIRST_VALUE(day) OVER w7, 0), 0) AS death_avg7
+FROM totals
+WINDOW
+    w AS (ORDER BY day),
+    w7 AS (ORDER BY day RANGE BETWEEN INTERVAL '7 days' PRECEDING AND CURRENT ROW);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_covid_world_daily_day ON covid19_world_daily(day);
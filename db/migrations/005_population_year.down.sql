@@ -0,0 +1,4 @@
+DELETE FROM population p USING population q WHERE p.country_code = q.country_code AND p.year < q.year;
+ALTER TABLE population DROP CONSTRAINT IF EXISTS population_pkey;
+ALTER TABLE population DROP COLUMN IF EXISTS year;
+ALTER TABLE population ADD PRIMARY KEY (country_code);
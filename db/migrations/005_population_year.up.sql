@@ -0,0 +1,5 @@
+ALTER TABLE population ADD COLUMN IF NOT EXISTS year INTEGER;
+UPDATE population SET year = EXTRACT(YEAR FROM CURRENT_DATE) WHERE year IS NULL;
+ALTER TABLE population ALTER COLUMN year SET NOT NULL;
+ALTER TABLE population DROP CONSTRAINT IF EXISTS population_pkey;
+ALTER TABLE population ADD PRIMARY KEY (country_code, year);
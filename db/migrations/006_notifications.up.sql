@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS notifications (
+  route TEXT NOT NULL,
+  country_name TEXT NOT NULL,
+  time TIMESTAMPTZ NOT NULL,
+  country_code TEXT NOT NULL,
+  confirmed BIGINT NOT NULL,
+  recovered BIGINT NOT NULL,
+  death BIGINT NOT NULL,
+  PRIMARY KEY (route, country_name)
+);
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS loads (
+  source TEXT PRIMARY KEY,
+  time TIMESTAMPTZ NOT NULL
+);
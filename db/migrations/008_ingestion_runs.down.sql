@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_covid_run_id;
+ALTER TABLE covid19 DROP COLUMN IF EXISTS run_id;
+DROP TABLE IF EXISTS ingestion_runs;
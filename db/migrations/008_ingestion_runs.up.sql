@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS ingestion_runs (
+  id BIGSERIAL PRIMARY KEY,
+  source TEXT NOT NULL,
+  start_time TIMESTAMPTZ NOT NULL,
+  end_time TIMESTAMPTZ,
+  inserted INTEGER NOT NULL DEFAULT 0,
+  error TEXT NOT NULL DEFAULT '',
+  config_hash TEXT NOT NULL DEFAULT '',
+  rolled_back TIMESTAMPTZ
+);
+ALTER TABLE covid19 ADD COLUMN IF NOT EXISTS run_id BIGINT REFERENCES ingestion_runs(id);
+CREATE INDEX IF NOT EXISTS idx_covid_run_id ON covid19(run_id);
@@ -0,0 +1,95 @@
+DROP MATERIALIZED VIEW IF EXISTS covid19_world_daily;
+DROP MATERIALIZED VIEW IF EXISTS covid19_daily;
+
+DROP INDEX IF EXISTS idx_covid_country_name;
+DROP INDEX IF EXISTS idx_covid_country_code;
+DROP INDEX IF EXISTS idx_covid_time;
+DROP INDEX IF EXISTS idx_covid_report_date;
+DROP INDEX IF EXISTS idx_covid_run_id;
+ALTER TABLE covid19 RENAME TO covid19_unpartitioned;
+
+CREATE TABLE covid19 (
+   time TIMESTAMPTZ,
+   country_code TEXT,
+   country_name TEXT,
+   confirmed BIGINT,
+   death BIGINT,
+   recovered BIGINT,
+   report_date DATE NOT NULL,
+   run_id BIGINT REFERENCES ingestion_runs(id)
+) PARTITION BY RANGE (time);
+-- catches rows without a timestamp, or for a month without a partition
+CREATE TABLE covid19_default PARTITION OF covid19 DEFAULT;
+
+-- covid19_create_partition creates the partition holding the rows for the (UTC) month of the provided date
+CREATE OR REPLACE FUNCTION covid19_create_partition(month DATE) RETURNS VOID AS $$
+DECLARE
+    start_time TIMESTAMPTZ := date_trunc('month', month::TIMESTAMP) AT TIME ZONE 'UTC';
+    partition_name TEXT := 'covid19_' || to_char(month, 'YYYY_MM');
+BEGIN
+    IF to_regclass(partition_name) IS NULL THEN
+        EXECUTE format('CREATE TABLE IF NOT EXISTS %I PARTITION OF covid19 FOR VALUES FROM (%L) TO (%L)',
+            partition_name, start_time, start_time + INTERVAL '1 month');
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+DO $$
+DECLARE
+    month DATE;
+BEGIN
+    FOR month IN SELECT DISTINCT date_trunc('month', time AT TIME ZONE 'UTC')::DATE FROM covid19_unpartitioned WHERE time IS NOT NULL LOOP
+        PERFORM covid19_create_partition(month);
+    END LOOP;
+END;
+$$;
+
+INSERT INTO covid19 (time, country_code, country_name, confirmed, death, recovered, report_date, run_id)
+    SELECT time, country_code, country_name, confirmed, death, recovered, report_date, run_id FROM covid19_unpartitioned;
+DROP TABLE covid19_unpartitioned;
+
+CREATE INDEX IF NOT EXISTS idx_covid_country_name ON covid19(country_name);
+CREATE INDEX IF NOT EXISTS idx_covid_country_code ON covid19(country_code);
+CREATE INDEX IF NOT EXISTS idx_covid_time ON covid19(time);
+CREATE INDEX IF NOT EXISTS idx_covid_report_date ON covid19(report_date);
+CREATE INDEX IF NOT EXISTS idx_covid_run_id ON covid19(run_id);
+
+-- the last entry per country per day is the one "db compact" keeps. ties on time are broken on the figures,
+-- so compacting doesn't change which entry is selected.
+CREATE MATERIALIZED VIEW IF NOT EXISTS covid19_daily AS
+WITH last_per_day AS (
+    SELECT DISTINCT ON (country_name, report_date)
+        report_date AS day, country_code, country_name, confirmed, death, recovered
+    FROM covid19
+    ORDER BY country_name, report_date, time DESC, confirmed DESC, death DESC, recovered DESC, country_code
+)
+SELECT
+    day, country_code, country_name, confirmed, death, recovered,
+    confirmed - LAG(confirmed, 1, 0::BIGINT) OVER w AS new_confirmed,
+    death - LAG(death, 1, 0::BIGINT) OVER w AS new_death,
+    COALESCE((confirmed - FIRST_VALUE(confirmed) OVER w7)::DOUBLE PRECISION / NULLIF(day - FIRST_VALUE(day) OVER w7, 0), 0) AS confirmed_avg7,
+    COALESCE((death - FIRST_VALUE(death) OVER w7)::DOUBLE PRECISION / NULLIF(day - FIRST_VALUE(day) OVER w7, 0), 0) AS death_avg7
+FROM last_per_day
+WINDOW
+    w AS (PARTITION BY country_name ORDER BY day),
+    w7 AS (PARTITION BY country_name ORDER BY day RANGE BETWEEN INTERVAL '7 days' PRECEDING AND CURRENT ROW);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_covid_daily_country_name_day ON covid19_daily(country_name, day);
+CREATE INDEX IF NOT EXISTS idx_covid_daily_day ON covid19_daily(day);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS covid19_world_daily AS
+WITH totals AS (
+    SELECT day, SUM(confirmed)::BIGINT AS confirmed, SUM(death)::BIGINT AS death, SUM(recovered)::BIGINT AS recovered
+    FROM covid19_daily
+    GROUP BY day
+)
+SELECT
+    day, confirmed, death, recovered,
+    confirmed - LAG(confirmed, 1, 0::BIGINT) OVER w AS new_confirmed,
+    death - LAG(death, 1, 0::BIGINT) OVER w AS new_death,
+    COALESCE((confirmed - FIRST_VALUE(confirmed) OVER w7)::DOUBLE PRECISION / NULLIF(day - FIRST_VALUE(day) OVER w7, 0), 0) AS confirmed_avg7,
+    COALESCE((death - FIRST_VALUE(death) OVER w7)::DOUBLE PRECISION / NULLIF(day - FIRST_VALUE(day) OVER w7, 0), 0) AS death_avg7
+FROM totals
+WINDOW
+    w AS (ORDER BY day),
+    w7 AS (ORDER BY day RANGE BETWEEN INTERVAL '7 days' PRECEDING AND CURRENT ROW);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_covid_world_daily_day ON covid19_world_daily(day);
@@ -0,0 +1,3 @@
+ALTER TABLE ingestion_runs DROP COLUMN IF EXISTS unknown_countries;
+ALTER TABLE ingestion_runs DROP COLUMN IF EXISTS rejected;
+ALTER TABLE ingestion_runs DROP COLUMN IF EXISTS fetched;
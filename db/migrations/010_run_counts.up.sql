@@ -0,0 +1,3 @@
+ALTER TABLE ingestion_runs ADD COLUMN IF NOT EXISTS fetched INTEGER;
+ALTER TABLE ingestion_runs ADD COLUMN IF NOT EXISTS rejected INTEGER;
+ALTER TABLE ingestion_runs ADD COLUMN IF NOT EXISTS unknown_countries INTEGER;
@@ -0,0 +1,17 @@
+package db
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/fs"
+	"testing"
+)
+
+func TestLatestMigration(t *testing.T) {
+	ups, err := fs.Glob(migrations, "migrations/*.up.sql")
+	require.NoError(t, err)
+
+	latest, err := latestMigration()
+	require.NoError(t, err)
+	assert.Equal(t, uint(len(ups)), latest)
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+	"github.com/clambin/covid19/models"
+	"github.com/clambin/covid19/tracing"
+)
+
+// PGNotificationStore records, for each notification route, the last entry that was notified for each country.
+// Alert rules record the report date of their last alert per country or region, under the route "alert:<rule name>".
+type PGNotificationStore struct {
+	DB *DB
+}
+
+// NewNotificationStore creates a new PGNotificationStore
+func NewNotificationStore(db *DB) *PGNotificationStore {
+	return &PGNotificationStore{DB: db}
+}
+
+// GetLastNotified returns the last notified entry for each country of a route
+func (store *PGNotificationStore) GetLastNotified(ctx context.Context, route string) (_ map[string]models.CountryEntry, err error) {
+	ctx, span := store.DB.startSpan(ctx, "PGNotificationStore.GetLastNotified")
+	defer func() { _ = tracing.End(span, err) }()
+
+	var rows []models.CountryEntry
+	if err = store.DB.selectContext(ctx, &rows,
+		`SELECT time "timestamp", country_code "code", country_name "name", confirmed, recovered, death "deaths" FROM notifications WHERE route = $1`,
+		route,
+	); err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]models.CountryEntry, len(rows))
+	for _, row := range rows {
+		entries[row.Name] = row
+	}
+	return entries, nil
+}
+
+// SetLastNotified records the last notified entry for a country of a route
+func (store *PGNotificationStore) SetLastNotified(ctx context.Context, route string, entry models.CountryEntry) error {
+	ctx, span := store.DB.startSpan(ctx, "PGNotificationStore.SetLastNotified")
+	_, err := store.DB.primaryHandle().ExecContext(ctx,
+		`INSERT INTO notifications(route, country_name, time, country_code, confirmed, recovered, death) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (route, country_name) DO UPDATE SET time = EXCLUDED.time, country_code = EXCLUDED.country_code, 
+		confirmed = EXCLUDED.confirmed, recovered = EXCLUDED.recovered, death = EXCLUDED.death`,
+		route, entry.Name, entry.Timestamp.UTC(), entry.Code, entry.Confirmed, entry.Recovered, entry.Deaths,
+	)
+	return tracing.End(span, err)
+}
@@ -0,0 +1,34 @@
+package db_test
+
+import (
+	"context"
+	"github.com/clambin/covid19/db"
+	"github.com/clambin/covid19/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestNotificationStore(t *testing.T) {
+	store := db.NewNotificationStore(DB)
+
+	entries, err := store.GetLastNotified(context.Background(), "test")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	entry := models.CountryEntry{Timestamp: time.Date(2023, time.March, 22, 6, 0, 0, 0, time.UTC), Code: "BE", Name: "Belgium", Confirmed: 100, Recovered: 50, Deaths: 25}
+	require.NoError(t, store.SetLastNotified(context.Background(), "test", entry))
+
+	entry.Timestamp = entry.Timestamp.Add(24 * time.Hour)
+	entry.Confirmed = 200
+	require.NoError(t, store.SetLastNotified(context.Background(), "test", entry))
+	require.NoError(t, store.SetLastNotified(context.Background(), "other", entry))
+
+	entries, err = store.GetLastNotified(context.Background(), "test")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.True(t, entry.Timestamp.Equal(entries["Belgium"].Timestamp))
+	entries["Belgium"] = entry
+	assert.Equal(t, map[string]models.CountryEntry{"Belgium": entry}, entries)
+}
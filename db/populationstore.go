@@ -1,7 +1,9 @@
 package db
 
 import (
-	"fmt"
+	"context"
+	"github.com/clambin/covid19/models"
+	"github.com/clambin/covid19/tracing"
 )
 
 // PGPopulationStore implements PopulationStore for Postgres databases
@@ -14,13 +16,16 @@ func NewPopulationStore(db *DB) *PGPopulationStore {
 	return &PGPopulationStore{DB: db}
 }
 
-// List all records from the Population table
-func (store *PGPopulationStore) List() (map[string]int64, error) {
+// List returns the most recent population figure for each country
+func (store *PGPopulationStore) List(ctx context.Context) (_ map[string]int64, err error) {
+	ctx, span := store.DB.startSpan(ctx, "PGPopulationStore.List")
+	defer func() { _ = tracing.End(span, err) }()
+
 	var rows []struct {
 		Code       string
 		Population int64
 	}
-	if err := store.DB.Handle.Select(&rows, `SELECT country_code AS "code", population FROM population`); err != nil {
+	if err = store.DB.selectContext(ctx, &rows, `SELECT DISTINCT ON (country_code) country_code AS "code", population FROM population ORDER BY country_code, year DESC`); err != nil {
 		return nil, err
 	}
 
@@ -31,14 +36,41 @@ func (store *PGPopulationStore) List() (map[string]int64, error) {
 	return entries, nil
 }
 
-// Add to Population database table. If a record for the specified country code already exists, it will be updated
-func (store *PGPopulationStore) Add(code string, pop int64) error {
-	stmt, err := store.DB.Handle.Prepare(fmt.Sprintf(
-		`INSERT INTO population(country_code, population) VALUES ('%s', %d) ON CONFLICT (country_code) DO UPDATE SET population = EXCLUDED.population`,
-		code, pop,
-	))
-	if err == nil {
-		_, err = stmt.Exec()
+// ListByYear returns all population figures, by country and year
+func (store *PGPopulationStore) ListByYear(ctx context.Context) (_ models.PopulationHistory, err error) {
+	ctx, span := store.DB.startSpan(ctx, "PGPopulationStore.ListByYear")
+	defer func() { _ = tracing.End(span, err) }()
+
+	var rows []struct {
+		Code       string
+		Year       int
+		Population int64
+	}
+	if err = store.DB.selectContext(ctx, &rows, `SELECT country_code AS "code", year, population FROM population`); err != nil {
+		return nil, err
 	}
-	return err
+
+	entries := make(models.PopulationHistory)
+	for _, row := range rows {
+		entries.Add(row.Code, row.Year, row.Population)
+	}
+	return entries, nil
+}
+
+// Rows returns the number of population figures in the store
+func (store *PGPopulationStore) Rows(ctx context.Context) (int, error) {
+	ctx, span := store.DB.startSpan(ctx, "PGPopulationStore.Rows")
+	var rows int
+	err := store.DB.getContext(ctx, &rows, `SELECT COUNT(*) AS rows FROM population`)
+	return rows, tracing.End(span, err)
+}
+
+// Add to Population database table. If a record for the specified country code and year already exists, it will be updated
+func (store *PGPopulationStore) Add(ctx context.Context, code string, year int, pop int64) error {
+	ctx, span := store.DB.startSpan(ctx, "PGPopulationStore.Add")
+	_, err := store.DB.primaryHandle().ExecContext(ctx,
+		`INSERT INTO population(country_code, year, population) VALUES ($1, $2, $3) ON CONFLICT (country_code, year) DO UPDATE SET population = EXCLUDED.population`,
+		code, year, pop,
+	)
+	return tracing.End(span, err)
 }
@@ -1,22 +1,41 @@
 package db_test
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 func TestPopulationStore(t *testing.T) {
-	_, err := popStore.List()
+	_, err := popStore.List(context.Background())
 	assert.NoError(t, err)
 
-	err = popStore.Add("???", 242)
+	err = popStore.Add(context.Background(), "???", 2020, 242)
+	require.NoError(t, err)
+	err = popStore.Add(context.Background(), "???", 2022, 252)
 	require.NoError(t, err)
 
-	newContent, err := popStore.List()
+	newContent, err := popStore.List(context.Background())
 	assert.NoError(t, err)
 
 	entry, ok := newContent["???"]
 	assert.True(t, ok)
-	assert.Equal(t, int64(242), entry)
+	assert.Equal(t, int64(252), entry)
+
+	err = popStore.Add(context.Background(), "???", 2022, 262)
+	require.NoError(t, err)
+
+	rows, err := popStore.Rows(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, rows)
+
+	history, err := popStore.ListByYear(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int64{2020: 242, 2022: 262}, history["???"])
+
+	pop, ok := history.Get("???", time.Date(2021, time.June, 1, 0, 0, 0, 0, time.UTC))
+	assert.True(t, ok)
+	assert.Equal(t, int64(242), pop)
 }
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/clambin/covid19/configuration"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"golang.org/x/exp/slog"
+	"net"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ReplicaRetryInterval is the time during which queries are sent to the primary after the read replica failed
+const ReplicaRetryInterval = 30 * time.Second
+
+// replica routes the read-only queries of a DB to a read replica. If the replica can't be reached, queries fall back to
+// the primary for ReplicaRetryInterval.
+type replica struct {
+	primary   *DB
+	downUntil atomic.Int64
+}
+
+// NewReplica creates a DB connector for the read replica configured in cfg.Replica. Read-only queries are sent to the
+// replica, falling back to the primary when the replica is down. Writes and migrations always use the primary.
+//
+// The replica is only connected when it is first queried, so commands that don't query it don't depend on it.
+func NewReplica(cfg configuration.PostgresDB, primary *DB) (*DB, error) {
+	dsn, err := replicaDataSourceName(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("replica: %w", err)
+	}
+	dbh, err := sqlx.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("replica: %w", err)
+	}
+	dbh.SetMaxOpenConns(cfg.MaxOpenConns)
+	if cfg.MaxIdleConns > 0 {
+		dbh.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	dbh.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	return &DB{
+		Handle:      dbh,
+		database:    primary.database,
+		lockTimeout: primary.lockTimeout,
+		Collector:   collectors.NewDBStatsCollector(dbh.DB, primary.database+"-replica"),
+		replica:     &replica{primary: primary},
+	}, nil
+}
+
+// replicaDataSourceName returns the libpq connection string for the read replica. Parameters that aren't set in
+// cfg.Replica are taken from the primary's configuration, so the replica uses the same TLS settings, connect timeout
+// and application name. Without a connect timeout, an unreachable replica would block queries until they are canceled,
+// rather than falling back to the primary.
+func replicaDataSourceName(cfg configuration.PostgresDB) (string, error) {
+	replica := cfg.Replica
+	if strings.Contains(replica, "://") {
+		var err error
+		if replica, err = pq.ParseURL(replica); err != nil {
+			// don't report the connection string: it may contain a password
+			return "", errors.New("invalid url")
+		}
+	}
+	// if a parameter is set more than once, the last value is used
+	return dataSourceName(cfg) + " " + replica, nil
+}
+
+// primaryHandle returns the handle for writes and migrations
+func (db *DB) primaryHandle() *sqlx.DB {
+	if db.replica != nil {
+		return db.replica.primary.Handle
+	}
+	return db.Handle
+}
+
+// selectContext runs a read-only query that returns rows
+func (db *DB) selectContext(ctx context.Context, dest any, query string, args ...any) error {
+	return db.read(ctx, dest, func(dbh *sqlx.DB) error {
+		return dbh.SelectContext(ctx, dest, query, args...)
+	})
+}
+
+// getContext runs a read-only query that returns a single row
+func (db *DB) getContext(ctx context.Context, dest any, query string, args ...any) error {
+	return db.read(ctx, dest, func(dbh *sqlx.DB) error {
+		return dbh.GetContext(ctx, dest, query, args...)
+	})
+}
+
+func (db *DB) read(ctx context.Context, dest any, query func(*sqlx.DB) error) error {
+	if db.replica == nil {
+		return query(db.Handle)
+	}
+	if time.Now().UnixNano() < db.replica.downUntil.Load() {
+		return query(db.replica.primary.Handle)
+	}
+
+	err := query(db.Handle)
+	if err == nil || ctx.Err() != nil || !isUnavailable(err) {
+		return err
+	}
+
+	slog.Warn("read replica unavailable. using primary", "err", err, "retryAfter", ReplicaRetryInterval)
+	db.replica.downUntil.Store(time.Now().Add(ReplicaRetryInterval).UnixNano())
+	// discard any rows received from the replica before it failed
+	v := reflect.ValueOf(dest).Elem()
+	v.Set(reflect.Zero(v.Type()))
+	return query(db.replica.primary.Handle)
+}
+
+// isUnavailable returns true if the query failed because the database can't be reached or isn't accepting queries
+func isUnavailable(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// class 08: connection exception. class 57: operator intervention, e.g. shutting down or starting up,
+		// except 57014: the query was canceled
+		return pqErr.Code.Class() == "08" || (pqErr.Code.Class() == "57" && pqErr.Code != "57014")
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDB_read(t *testing.T) {
+	primary := &DB{Handle: &sqlx.DB{}}
+	replicaDB := &DB{Handle: &sqlx.DB{}, replica: &replica{primary: primary}}
+	ctx := context.Background()
+
+	var replicaErr error
+	query := func(dest *[]string) func(*sqlx.DB) error {
+		return func(dbh *sqlx.DB) error {
+			if dbh == replicaDB.Handle {
+				*dest = append(*dest, "replica")
+				return replicaErr
+			}
+			*dest = append(*dest, "primary")
+			return nil
+		}
+	}
+
+	var result []string
+	assert.NoError(t, replicaDB.read(ctx, &result, query(&result)))
+	assert.Equal(t, []string{"replica"}, result)
+
+	// queries that fail on the replica itself are not retried
+	replicaErr = sql.ErrNoRows
+	result = nil
+	assert.ErrorIs(t, replicaDB.read(ctx, &result, query(&result)), sql.ErrNoRows)
+	assert.Equal(t, []string{"replica"}, result)
+
+	// if the replica is down, the primary is used
+	replicaErr = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	result = nil
+	assert.NoError(t, replicaDB.read(ctx, &result, query(&result)))
+	assert.Equal(t, []string{"primary"}, result)
+
+	// until the retry interval expires
+	replicaErr = nil
+	result = nil
+	assert.NoError(t, replicaDB.read(ctx, &result, query(&result)))
+	assert.Equal(t, []string{"primary"}, result)
+
+	replicaDB.replica.downUntil.Store(time.Now().Add(-time.Second).UnixNano())
+	result = nil
+	assert.NoError(t, replicaDB.read(ctx, &result, query(&result)))
+	assert.Equal(t, []string{"replica"}, result)
+
+	// without a replica, queries go to the primary
+	result = nil
+	assert.NoError(t, primary.read(ctx, &result, query(&result)))
+	assert.Equal(t, []string{"primary"}, result)
+}
+
+func TestIsUnavailable(t *testing.T) {
+	assert.True(t, isUnavailable(&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}))
+	assert.True(t, isUnavailable(&pq.Error{Code: "57P01", Message: "terminating connection due to administrator command"}))
+	assert.True(t, isUnavailable(&pq.Error{Code: "08006", Message: "connection failure"}))
+	assert.False(t, isUnavailable(&pq.Error{Code: "57014", Message: "canceling statement due to user request"}))
+	assert.False(t, isUnavailable(&pq.Error{Code: "42P01", Message: "relation does not exist"}))
+	assert.False(t, isUnavailable(sql.ErrNoRows))
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/clambin/covid19/tracing"
+	"time"
+)
+
+// PGRunStore keeps an audit log of the loader runs. Each covid19 row is stamped with the id of the run that added it
+// (see PGCovidStore.ForRun), so all rows of a run can be rolled back.
+type PGRunStore struct {
+	DB *DB
+}
+
+// NewRunStore creates a new PGRunStore
+func NewRunStore(db *DB) *PGRunStore {
+	return &PGRunStore{DB: db}
+}
+
+// IngestionRun records a single run of the loader or population command
+type IngestionRun struct {
+	ID     int64
+	Source string
+	Start  time.Time
+	// End is nil while the run is in progress, or if it didn't complete
+	End *time.Time
+	// Inserted is the number of covid19 rows added by the run
+	Inserted int
+	// Fetched, Rejected and UnknownCountries are the RunCounts of a loader run. Nil for population runs, and for runs
+	// that didn't record them
+	Fetched          *int
+	Rejected         *int
+	UnknownCountries *int
+	// Error is the reason the run failed. Blank if it succeeded
+	Error      string
+	ConfigHash string
+	// RolledBack is the time the rows of the run were deleted. Nil if the run wasn't rolled back
+	RolledBack *time.Time
+}
+
+// ErrRunNotFound indicates that the run doesn't exist
+var ErrRunNotFound = errors.New("run not found")
+
+// RunCounts are the numbers of entries processed by a loader run, as recorded by EndRun
+type RunCounts struct {
+	// Fetched is the number of entries received from the COVID-19 API
+	Fetched int
+	// Rejected is the number of entries dropped because their country isn't supported
+	Rejected int
+	// UnknownCountries is the number of distinct unknown country names received from the COVID-19 API
+	UnknownCountries int
+}
+
+// StartRun records the start of a run and returns its id
+func (store *PGRunStore) StartRun(ctx context.Context, source, configHash string) (int64, error) {
+	ctx, span := store.DB.startSpan(ctx, "PGRunStore.StartRun")
+	var id int64
+	err := store.DB.primaryHandle().GetContext(ctx, &id,
+		`INSERT INTO ingestion_runs(source, start_time, config_hash) VALUES ($1, $2, $3) RETURNING id`,
+		source, time.Now().UTC(), configHash,
+	)
+	return id, tracing.End(span, err)
+}
+
+// EndRun records the end of a run. If counts is nil, no counts are recorded. If the run failed, runErr is recorded as the reason
+func (store *PGRunStore) EndRun(ctx context.Context, id int64, counts *RunCounts, runErr error) error {
+	ctx, span := store.DB.startSpan(ctx, "PGRunStore.EndRun")
+	var reason string
+	if runErr != nil {
+		reason = runErr.Error()
+	}
+	var fetched, rejected, unknown sql.NullInt64
+	if counts != nil {
+		fetched = sql.NullInt64{Int64: int64(counts.Fetched), Valid: true}
+		rejected = sql.NullInt64{Int64: int64(counts.Rejected), Valid: true}
+		unknown = sql.NullInt64{Int64: int64(counts.UnknownCountries), Valid: true}
+	}
+	_, err := store.DB.primaryHandle().ExecContext(ctx,
+		`UPDATE ingestion_runs SET end_time = $2, error = $3, fetched = $4, rejected = $5, unknown_countries = $6 WHERE id = $1`,
+		id, time.Now().UTC(), reason, fetched, rejected, unknown,
+	)
+	return tracing.End(span, err)
+}
+
+// ListRuns returns the most recent runs, newest first. If limit is zero, all runs are returned
+func (store *PGRunStore) ListRuns(ctx context.Context, limit int) ([]IngestionRun, error) {
+	ctx, span := store.DB.startSpan(ctx, "PGRunStore.ListRuns")
+	statement := `SELECT id, source, start_time "start", end_time "end", inserted, fetched, rejected, unknown_countries "unknowncountries", error, config_hash "confighash", rolled_back "rolledback" FROM ingestion_runs ORDER BY id DESC`
+	if limit > 0 {
+		statement += fmt.Sprintf(` LIMIT %d`, limit)
+	}
+	var runs []IngestionRun
+	err := store.DB.selectContext(ctx, &runs, statement)
+	return runs, tracing.End(span, err)
+}
+
+// Rollback deletes all covid19 rows added by a run and marks the run as rolled back. It returns the number of deleted rows
+func (store *PGRunStore) Rollback(ctx context.Context, id int64) (deleted int64, err error) {
+	ctx, span := store.DB.startSpan(ctx, "PGRunStore.Rollback")
+	defer func() { _ = tracing.End(span, err) }()
+
+	tx, err := store.DB.primaryHandle().BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		// will be ignored if we commit before the function returns
+		_ = tx.Rollback()
+	}()
+
+	var rolledBack sql.NullTime
+	err = tx.GetContext(ctx, &rolledBack, `SELECT rolled_back FROM ingestion_runs WHERE id = $1 FOR UPDATE`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("run %d: %w", id, ErrRunNotFound)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if rolledBack.Valid {
+		return 0, fmt.Errorf("run %d was already rolled back at %s", id, rolledBack.Time.UTC().Format(time.RFC3339))
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM covid19 WHERE run_id = $1`, id)
+	if err != nil {
+		return 0, err
+	}
+	if deleted, err = result.RowsAffected(); err != nil {
+		return 0, err
+	}
+	if _, err = tx.ExecContext(ctx, `UPDATE ingestion_runs SET rolled_back = $2 WHERE id = $1`, id, time.Now().UTC()); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	store.DB.refreshViews(ctx)
+	return deleted, nil
+}
@@ -0,0 +1,84 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"github.com/clambin/covid19/db"
+	"github.com/clambin/covid19/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRunStore(t *testing.T) {
+	store := db.NewRunStore(DB)
+	ctx := context.Background()
+
+	rows, err := covidStore.Rows(ctx)
+	require.NoError(t, err)
+
+	id, err := store.StartRun(ctx, "covid", "abcd")
+	require.NoError(t, err)
+
+	timestamp := time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)
+	err = covidStore.ForRun(id).Add(ctx, []models.CountryEntry{
+		{Timestamp: timestamp, Code: "!!", Name: "!!!", Confirmed: 1},
+		{Timestamp: timestamp.Add(24 * time.Hour), Code: "!!", Name: "!!!", Confirmed: 2},
+	})
+	require.NoError(t, err)
+	require.NoError(t, store.EndRun(ctx, id, &db.RunCounts{Fetched: 5, Rejected: 3, UnknownCountries: 1}, errors.New("fail")))
+
+	runs, err := store.ListRuns(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, id, runs[0].ID)
+	assert.Equal(t, "covid", runs[0].Source)
+	assert.Equal(t, 2, runs[0].Inserted)
+	require.NotNil(t, runs[0].Fetched)
+	assert.Equal(t, 5, *runs[0].Fetched)
+	require.NotNil(t, runs[0].Rejected)
+	assert.Equal(t, 3, *runs[0].Rejected)
+	require.NotNil(t, runs[0].UnknownCountries)
+	assert.Equal(t, 1, *runs[0].UnknownCountries)
+	assert.Equal(t, "fail", runs[0].Error)
+	assert.Equal(t, "abcd", runs[0].ConfigHash)
+	assert.NotNil(t, runs[0].End)
+	assert.Nil(t, runs[0].RolledBack)
+
+	deleted, err := store.Rollback(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	current, err := covidStore.Rows(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, rows, current)
+
+	runs, err = store.ListRuns(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.NotNil(t, runs[0].RolledBack)
+
+	_, err = store.Rollback(ctx, id)
+	assert.Error(t, err)
+	_, err = store.Rollback(ctx, id+1)
+	assert.ErrorIs(t, err, db.ErrRunNotFound)
+}
+
+func TestRunStore_NoCounts(t *testing.T) {
+	store := db.NewRunStore(DB)
+	ctx := context.Background()
+
+	id, err := store.StartRun(ctx, "population", "")
+	require.NoError(t, err)
+	require.NoError(t, store.EndRun(ctx, id, nil, nil))
+
+	runs, err := store.ListRuns(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, id, runs[0].ID)
+	assert.Nil(t, runs[0].Fetched)
+	assert.Nil(t, runs[0].Rejected)
+	assert.Nil(t, runs[0].UnknownCountries)
+	assert.Empty(t, runs[0].Error)
+}
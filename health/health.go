@@ -0,0 +1,209 @@
+// Package health implements the liveness, readiness and status endpoints of the handler.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/clambin/covid19/covid"
+	"golang.org/x/exp/slog"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Handler serves the /healthz, /readyz and /status endpoints
+type Handler struct {
+	DB         Readier
+	Covid      CovidGetter
+	Population PopulationGetter
+	Loads      LoadGetter
+	// Timeout for the database queries of a single request
+	Timeout time.Duration
+}
+
+// Readier checks that the database can be used
+type Readier interface {
+	Ready(context.Context) error
+}
+
+// CovidGetter returns the size and age of the covid19 figures
+type CovidGetter interface {
+	Rows(context.Context) (int, error)
+	GetLatestTimestamp(context.Context) (time.Time, error)
+	GetAllCountryNames(context.Context) ([]string, error)
+}
+
+// PopulationGetter returns the population figures
+type PopulationGetter interface {
+	Rows(context.Context) (int, error)
+	List(context.Context) (map[string]int64, error)
+}
+
+// LoadGetter returns the time of the last successful load of each data source
+type LoadGetter interface {
+	GetLastLoads(context.Context) (map[string]time.Time, error)
+}
+
+// DefaultTimeout is the default timeout for the database queries of a single request
+const DefaultTimeout = 5 * time.Second
+
+// Sources used to record the last successful load of the covid19 and population figures
+const (
+	CovidSource      = "covid"
+	PopulationSource = "population"
+)
+
+// Status is the response of the /status endpoint
+type Status struct {
+	Sources Sources `json:"sources"`
+}
+
+// Sources holds the status of each data source
+type Sources struct {
+	Covid      CovidStatus      `json:"covid"`
+	Population PopulationStatus `json:"population"`
+}
+
+// CovidStatus is the status of the covid19 figures
+type CovidStatus struct {
+	LastLoad *time.Time `json:"lastLoad"`
+	Newest   *time.Time `json:"newest"`
+	Rows     int        `json:"rows"`
+}
+
+// PopulationStatus is the status of the population figures
+type PopulationStatus struct {
+	LastLoad *time.Time `json:"lastLoad"`
+	Rows     int        `json:"rows"`
+	Coverage Coverage   `json:"coverage"`
+}
+
+// Coverage reports how many of the countries with covid19 figures have population figures
+type Coverage struct {
+	Countries int      `json:"countries"`
+	Covered   int      `json:"covered"`
+	Missing   []string `json:"missing"`
+}
+
+// Register adds the endpoints to the provided ServeMux
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", h.Healthz)
+	mux.HandleFunc("/readyz", h.Readyz)
+	mux.HandleFunc("/status", h.Status)
+}
+
+// Healthz reports that the process is alive
+func (h *Handler) Healthz(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readyz reports whether the database is reachable and all migrations have been applied
+func (h *Handler) Readyz(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := h.context(req)
+	defer cancel()
+
+	if err := h.DB.Ready(ctx); err != nil {
+		slog.Warn("not ready", "err", err)
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Status reports the state of each data source
+func (h *Handler) Status(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := h.context(req)
+	defer cancel()
+
+	status, err := h.getStatus(ctx)
+	if err != nil {
+		slog.Warn("failed to get status", "err", err)
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (h *Handler) context(req *http.Request) (context.Context, context.CancelFunc) {
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return context.WithTimeout(req.Context(), timeout)
+}
+
+func (h *Handler) getStatus(ctx context.Context) (status Status, err error) {
+	loads, err := h.Loads.GetLastLoads(ctx)
+	if err != nil {
+		return status, fmt.Errorf("last loads: %w", err)
+	}
+	if status.Sources.Covid, err = h.getCovidStatus(ctx); err != nil {
+		return status, fmt.Errorf("covid: %w", err)
+	}
+	if status.Sources.Population, err = h.getPopulationStatus(ctx); err != nil {
+		return status, fmt.Errorf("population: %w", err)
+	}
+	status.Sources.Covid.LastLoad = timeOrNil(loads[CovidSource])
+	status.Sources.Population.LastLoad = timeOrNil(loads[PopulationSource])
+	return status, nil
+}
+
+func (h *Handler) getCovidStatus(ctx context.Context) (status CovidStatus, err error) {
+	if status.Rows, err = h.Covid.Rows(ctx); err != nil {
+		return status, err
+	}
+	newest, err := h.Covid.GetLatestTimestamp(ctx)
+	status.Newest = timeOrNil(newest)
+	return status, err
+}
+
+func (h *Handler) getPopulationStatus(ctx context.Context) (status PopulationStatus, err error) {
+	if status.Rows, err = h.Population.Rows(ctx); err != nil {
+		return status, err
+	}
+	names, err := h.Covid.GetAllCountryNames(ctx)
+	if err != nil {
+		return status, err
+	}
+	population, err := h.Population.List(ctx)
+	if err != nil {
+		return status, err
+	}
+
+	status.Coverage.Missing = make([]string, 0)
+	for _, name := range names {
+		code, found := covid.CountryCodes[name]
+		if !found {
+			continue
+		}
+		status.Coverage.Countries++
+		if _, found = population[code]; found {
+			status.Coverage.Covered++
+		} else {
+			status.Coverage.Missing = append(status.Coverage.Missing, name)
+		}
+	}
+	sort.Strings(status.Coverage.Missing)
+	return status, nil
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "error", "error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Warn("failed to write response", "err", err)
+	}
+}
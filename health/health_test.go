@@ -0,0 +1,113 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"github.com/clambin/covid19/health"
+	"github.com/clambin/covid19/internal/testtools/db/covid"
+	"github.com/clambin/covid19/internal/testtools/db/population"
+	"github.com/clambin/covid19/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler_Healthz(t *testing.T) {
+	h := health.Handler{DB: fakeDB{err: errors.New("db down")}}
+
+	w := httptest.NewRecorder()
+	h.Healthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestHandler_Readyz(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode int
+		wantBody string
+	}{
+		{name: "ready", wantCode: http.StatusOK, wantBody: `{"status":"ok"}`},
+		{name: "not ready", err: errors.New("1 pending migration(s)"), wantCode: http.StatusServiceUnavailable, wantBody: `{"status":"error","error":"1 pending migration(s)"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := health.Handler{DB: fakeDB{err: tt.err}}
+
+			w := httptest.NewRecorder()
+			h.Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			assert.JSONEq(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func TestHandler_Status(t *testing.T) {
+	timestamp := time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC)
+	covidStore := covid.FakeStore{Records: []models.CountryEntry{
+		{Timestamp: timestamp.Add(-24 * time.Hour), Code: "BE", Name: "Belgium", Confirmed: 1},
+		{Timestamp: timestamp, Code: "BE", Name: "Belgium", Confirmed: 2},
+		{Timestamp: timestamp, Code: "US", Name: "US", Confirmed: 3},
+		{Timestamp: timestamp, Code: "NL", Name: "Netherlands", Confirmed: 4},
+	}}
+	populationStore := population.FakeStore{Content: models.PopulationHistory{
+		"BE": {2022: 11_000_000, 2023: 11_500_000},
+		"US": {2023: 330_000_000},
+	}}
+	h := health.Handler{
+		Covid:      &covidStore,
+		Population: &populationStore,
+		Loads:      fakeLoads{health.CovidSource: timestamp.Add(time.Hour)},
+	}
+
+	w := httptest.NewRecorder()
+	h.Status(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+  "sources": {
+    "covid": { "lastLoad": "2023-05-01T13:00:00Z", "newest": "2023-05-01T12:00:00Z", "rows": 4 },
+    "population": {
+      "lastLoad": null,
+      "rows": 3,
+      "coverage": { "countries": 3, "covered": 2, "missing": ["Netherlands"] }
+    }
+  }
+}`, w.Body.String())
+
+	covidStore.Fail = true
+	w = httptest.NewRecorder()
+	h.Status(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"status":"error","error":"covid: fail"}`, w.Body.String())
+}
+
+func TestHandler_Register(t *testing.T) {
+	h := health.Handler{DB: fakeDB{}}
+	mux := http.NewServeMux()
+	h.Register(mux)
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, w.Code, path)
+	}
+}
+
+type fakeDB struct {
+	err error
+}
+
+func (f fakeDB) Ready(_ context.Context) error {
+	return f.err
+}
+
+type fakeLoads map[string]time.Time
+
+func (f fakeLoads) GetLastLoads(_ context.Context) (map[string]time.Time, error) {
+	return f, nil
+}
@@ -1,6 +1,7 @@
 package covid
 
 import (
+	"context"
 	"errors"
 	"github.com/clambin/covid19/db"
 	"github.com/clambin/covid19/models"
@@ -12,10 +13,9 @@ import (
 type FakeStore struct {
 	Records []models.CountryEntry
 	Fail    bool
-	NoSort  bool
 }
 
-func (f *FakeStore) Add(entries []models.CountryEntry) error {
+func (f *FakeStore) Add(_ context.Context, entries []models.CountryEntry) error {
 	if f.Fail {
 		return errors.New("fail")
 	}
@@ -23,7 +23,7 @@ func (f *FakeStore) Add(entries []models.CountryEntry) error {
 	return nil
 }
 
-func (f *FakeStore) GetLatestForCountries(t time.Time) (map[string]models.CountryEntry, error) {
+func (f *FakeStore) GetLatestForCountries(_ context.Context, t time.Time) (map[string]models.CountryEntry, error) {
 	if f.Fail {
 		return nil, errors.New("fail")
 	}
@@ -42,7 +42,7 @@ func (f *FakeStore) GetLatestForCountries(t time.Time) (map[string]models.Countr
 	return records, nil
 }
 
-func (f *FakeStore) GetAllForCountryName(s string) ([]models.CountryEntry, error) {
+func (f *FakeStore) GetAllForCountryName(_ context.Context, s string) ([]models.CountryEntry, error) {
 	records := make([]models.CountryEntry, 0, len(f.Records))
 	for _, record := range f.Records {
 		if record.Name == s {
@@ -52,7 +52,7 @@ func (f *FakeStore) GetAllForCountryName(s string) ([]models.CountryEntry, error
 	return records, nil
 }
 
-func (f *FakeStore) GetAllCountryNames() ([]string, error) {
+func (f *FakeStore) GetAllCountryNames(_ context.Context) ([]string, error) {
 	countryNames := set.Create[string]()
 	for _, record := range f.Records {
 		countryNames.Add(record.Name)
@@ -62,32 +62,126 @@ func (f *FakeStore) GetAllCountryNames() ([]string, error) {
 	return names, nil
 }
 
-func (f *FakeStore) GetTotalsPerDay() ([]models.CountryEntry, error) {
-	records := make([]models.CountryEntry, len(f.Records))
-	copy(records, f.Records)
-	if !f.NoSort {
-		sort.Slice(records, func(i, j int) bool {
-			return records[i].Timestamp.Before(records[j].Timestamp)
-		})
+func (f *FakeStore) GetTotalsPerDay(_ context.Context) ([]models.DailyEntry, error) {
+	if f.Fail {
+		return nil, errors.New("fail")
+	}
+	totals := make(map[time.Time]models.DailyEntry)
+	for _, entry := range f.daily() {
+		total := totals[entry.Timestamp]
+		total.Timestamp = entry.Timestamp
+		total.Confirmed += entry.Confirmed
+		total.Recovered += entry.Recovered
+		total.Deaths += entry.Deaths
+		totals[entry.Timestamp] = total
 	}
 
-	result := make([]models.CountryEntry, 0, len(records))
-	row := -1
+	result := make([]models.DailyEntry, 0, len(totals))
+	for _, total := range totals {
+		result = append(result, total)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Timestamp.Before(result[j].Timestamp)
+	})
+	return withDeltas(result), nil
+}
 
-	for _, record := range records {
-		if len(result) == 0 || !result[row].Timestamp.Equal(record.Timestamp) {
-			result = append(result, models.CountryEntry{Timestamp: record.Timestamp})
-			row++
+func (f *FakeStore) GetDailyForCountryName(_ context.Context, s string) ([]models.DailyEntry, error) {
+	if f.Fail {
+		return nil, errors.New("fail")
+	}
+	var result []models.DailyEntry
+	for _, entry := range f.daily() {
+		if entry.Name == s {
+			result = append(result, entry)
 		}
-		result[row].Confirmed += record.Confirmed
-		result[row].Recovered += record.Recovered
-		result[row].Deaths += record.Deaths
 	}
+	return result, nil
+}
 
+func (f *FakeStore) GetDailyForRange(_ context.Context, from, to time.Time) ([]models.DailyEntry, error) {
+	if f.Fail {
+		return nil, errors.New("fail")
+	}
+	var result []models.DailyEntry
+	for _, entry := range f.daily() {
+		if (!from.IsZero() && entry.Timestamp.Before(from.Truncate(24*time.Hour))) ||
+			(!to.IsZero() && entry.Timestamp.After(to)) {
+			continue
+		}
+		result = append(result, entry)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Timestamp.Before(result[j].Timestamp)
+	})
 	return result, nil
 }
 
-func (f *FakeStore) GetAllForRange(from time.Time, to time.Time) ([]models.CountryEntry, error) {
+// daily mimics the covid19_daily materialized view: the last entry per country per report date, with daily increases
+// and the average increase over the last seven days
+func (f *FakeStore) daily() []models.DailyEntry {
+	lastPerDay := make(map[string]map[time.Time]models.CountryEntry)
+	for _, record := range f.Records {
+		days, ok := lastPerDay[record.Name]
+		if !ok {
+			days = make(map[time.Time]models.CountryEntry)
+			lastPerDay[record.Name] = days
+		}
+		day := record.GetReportDate()
+		if current, ok := days[day]; !ok || record.Timestamp.After(current.Timestamp) {
+			days[day] = record
+		}
+	}
+
+	names := make([]string, 0, len(lastPerDay))
+	for name := range lastPerDay {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result []models.DailyEntry
+	for _, name := range names {
+		entries := make([]models.DailyEntry, 0, len(lastPerDay[name]))
+		for day, record := range lastPerDay[name] {
+			entries = append(entries, models.DailyEntry{
+				Timestamp: day,
+				Code:      record.Code,
+				Name:      record.Name,
+				Confirmed: record.Confirmed,
+				Recovered: record.Recovered,
+				Deaths:    record.Deaths,
+			})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Timestamp.Before(entries[j].Timestamp)
+		})
+		result = append(result, withDeltas(entries)...)
+	}
+	return result
+}
+
+func withDeltas(entries []models.DailyEntry) []models.DailyEntry {
+	for idx := range entries {
+		var previous models.DailyEntry
+		if idx > 0 {
+			previous = entries[idx-1]
+		}
+		entries[idx].NewConfirmed = entries[idx].Confirmed - previous.Confirmed
+		entries[idx].NewDeaths = entries[idx].Deaths - previous.Deaths
+
+		first := idx
+		for first > 0 && !entries[first-1].Timestamp.Before(entries[idx].Timestamp.Add(-7*24*time.Hour)) {
+			first--
+		}
+		if days := entries[idx].Timestamp.Sub(entries[first].Timestamp).Hours() / 24; days > 0 {
+			entries[idx].ConfirmedAverage = float64(entries[idx].Confirmed-entries[first].Confirmed) / days
+			entries[idx].DeathsAverage = float64(entries[idx].Deaths-entries[first].Deaths) / days
+		}
+	}
+	return entries
+}
+
+func (f *FakeStore) GetAllForRange(_ context.Context, from time.Time, to time.Time) ([]models.CountryEntry, error) {
 	var filteredRecords []models.CountryEntry
 	for _, record := range f.Records {
 		if (!from.IsZero() && record.Timestamp.Before(from)) ||
@@ -102,7 +196,7 @@ func (f *FakeStore) GetAllForRange(from time.Time, to time.Time) ([]models.Count
 	return filteredRecords, nil
 }
 
-func (f *FakeStore) CountEntriesByTime(from time.Time, to time.Time) ([]db.TimestampCount, error) {
+func (f *FakeStore) CountEntriesByTime(_ context.Context, from time.Time, to time.Time) ([]db.TimestampCount, error) {
 	count := make(map[time.Time]int)
 	for _, record := range f.Records {
 		if (!from.IsZero() && record.Timestamp.Before(from)) ||
@@ -120,3 +214,23 @@ func (f *FakeStore) CountEntriesByTime(from time.Time, to time.Time) ([]db.Times
 	})
 	return timestampCount, nil
 }
+
+func (f *FakeStore) Rows(_ context.Context) (int, error) {
+	if f.Fail {
+		return 0, errors.New("fail")
+	}
+	return len(f.Records), nil
+}
+
+func (f *FakeStore) GetLatestTimestamp(_ context.Context) (time.Time, error) {
+	if f.Fail {
+		return time.Time{}, errors.New("fail")
+	}
+	var latest time.Time
+	for _, record := range f.Records {
+		if record.Timestamp.After(latest) {
+			latest = record.Timestamp
+		}
+	}
+	return latest, nil
+}
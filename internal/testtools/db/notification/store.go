@@ -0,0 +1,37 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"github.com/clambin/covid19/models"
+)
+
+type FakeStore struct {
+	Content map[string]map[string]models.CountryEntry
+	Fail    bool
+}
+
+func (f *FakeStore) GetLastNotified(_ context.Context, route string) (map[string]models.CountryEntry, error) {
+	if f.Fail {
+		return nil, errors.New("db error")
+	}
+	entries := make(map[string]models.CountryEntry)
+	for name, entry := range f.Content[route] {
+		entries[name] = entry
+	}
+	return entries, nil
+}
+
+func (f *FakeStore) SetLastNotified(_ context.Context, route string, entry models.CountryEntry) error {
+	if f.Fail {
+		return errors.New("db error")
+	}
+	if f.Content == nil {
+		f.Content = make(map[string]map[string]models.CountryEntry)
+	}
+	if f.Content[route] == nil {
+		f.Content[route] = make(map[string]models.CountryEntry)
+	}
+	f.Content[route][entry.Name] = entry
+	return nil
+}
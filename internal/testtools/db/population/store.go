@@ -1,26 +1,48 @@
 package population
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"github.com/clambin/covid19/models"
+)
 
 type FakeStore struct {
-	Content map[string]int64
+	Content models.PopulationHistory
 	Fail    bool
 }
 
-func (f *FakeStore) List() (map[string]int64, error) {
+func (f *FakeStore) List(_ context.Context) (map[string]int64, error) {
+	if f.Fail {
+		return nil, errors.New("db error")
+	}
+	return f.Content.Latest(), nil
+}
+
+func (f *FakeStore) ListByYear(_ context.Context) (models.PopulationHistory, error) {
 	if f.Fail {
 		return nil, errors.New("db error")
 	}
 	return f.Content, nil
 }
 
-func (f *FakeStore) Add(s string, i int64) error {
+func (f *FakeStore) Add(_ context.Context, s string, year int, i int64) error {
 	if f.Fail {
 		return errors.New("db error")
 	}
 	if f.Content == nil {
-		f.Content = make(map[string]int64)
+		f.Content = make(models.PopulationHistory)
 	}
-	f.Content[s] = i
+	f.Content.Add(s, year, i)
 	return nil
 }
+
+func (f *FakeStore) Rows(_ context.Context) (int, error) {
+	if f.Fail {
+		return 0, errors.New("db error")
+	}
+	var rows int
+	for _, years := range f.Content {
+		rows += len(years)
+	}
+	return rows, nil
+}
@@ -4,10 +4,27 @@ import "time"
 
 // CountryEntry represents one entry of COVID-19 statistics
 type CountryEntry struct {
-	Timestamp time.Time
-	Code      string
-	Name      string
-	Confirmed int64
-	Recovered int64
-	Deaths    int64
+	Timestamp  time.Time
+	ReportDate time.Time
+	Code       string
+	Name       string
+	Confirmed  int64
+	Recovered  int64
+	Deaths     int64
+}
+
+// ReportDate returns the calendar day that figures, published upstream at the provided update timestamp, belong to.
+// Upstream sources publish a day's figures after that day has ended (in UTC), so this is the UTC calendar day before
+// the update.
+func ReportDate(timestamp time.Time) time.Time {
+	year, month, day := timestamp.UTC().AddDate(0, 0, -1).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// GetReportDate returns the entry's ReportDate. If it is not set, it is derived from the entry's Timestamp
+func (entry CountryEntry) GetReportDate() time.Time {
+	if !entry.ReportDate.IsZero() {
+		return entry.ReportDate
+	}
+	return ReportDate(entry.Timestamp)
 }
@@ -0,0 +1,75 @@
+package models_test
+
+import (
+	"github.com/clambin/covid19/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestReportDate(t *testing.T) {
+	brussels, err := time.LoadLocation("Europe/Brussels")
+	require.NoError(t, err)
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		timestamp time.Time
+		want      time.Time
+	}{
+		{
+			name:      "utc",
+			timestamp: time.Date(2020, time.December, 3, 5, 28, 22, 0, time.UTC),
+			want:      time.Date(2020, time.December, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "midnight utc",
+			timestamp: time.Date(2020, time.January, 23, 0, 0, 0, 0, time.UTC),
+			want:      time.Date(2020, time.January, 22, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "local midnight is previous day in utc",
+			timestamp: time.Date(2023, time.March, 21, 0, 30, 0, 0, brussels),
+			want:      time.Date(2023, time.March, 19, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "before dst start",
+			timestamp: time.Date(2023, time.March, 26, 0, 30, 0, 0, brussels),
+			want:      time.Date(2023, time.March, 24, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "after dst start",
+			timestamp: time.Date(2023, time.March, 26, 3, 30, 0, 0, brussels),
+			want:      time.Date(2023, time.March, 25, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "ambiguous hour at dst end",
+			timestamp: time.Date(2023, time.October, 29, 2, 30, 0, 0, brussels),
+			want:      time.Date(2023, time.October, 28, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "dst end west of utc",
+			timestamp: time.Date(2023, time.November, 5, 20, 0, 0, 0, newYork),
+			want:      time.Date(2023, time.November, 5, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := models.ReportDate(tt.timestamp)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, time.UTC, got.Location())
+		})
+	}
+}
+
+func TestCountryEntry_GetReportDate(t *testing.T) {
+	entry := models.CountryEntry{Timestamp: time.Date(2023, time.March, 21, 5, 0, 0, 0, time.UTC)}
+	assert.Equal(t, time.Date(2023, time.March, 20, 0, 0, 0, 0, time.UTC), entry.GetReportDate())
+
+	entry.ReportDate = time.Date(2023, time.March, 21, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, entry.ReportDate, entry.GetReportDate())
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// DailyEntry represents the aggregated COVID-19 statistics for one day. Confirmed & Deaths are cumulative figures;
+// NewConfirmed & NewDeaths are the increase since the previous day. The averages hold the average daily increase
+// over the last seven days
+type DailyEntry struct {
+	Timestamp        time.Time
+	Code             string
+	Name             string
+	Confirmed        int64
+	Recovered        int64
+	Deaths           int64
+	NewConfirmed     int64
+	NewDeaths        int64
+	ConfirmedAverage float64
+	DeathsAverage    float64
+}
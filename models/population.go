@@ -0,0 +1,54 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// PopulationHistory holds the population of each country (by country code) by year
+type PopulationHistory map[string]map[int]int64
+
+// Add records the population of a country for the specified year
+func (p PopulationHistory) Add(code string, year int, population int64) {
+	years, ok := p[code]
+	if !ok {
+		years = make(map[int]int64)
+		p[code] = years
+	}
+	years[year] = population
+}
+
+// Get returns the population of a country valid at the specified time. This is the figure for that year or, if that
+// year is missing, the most recent earlier year. If there are no earlier figures, the earliest later figure is used
+func (p PopulationHistory) Get(code string, timestamp time.Time) (int64, bool) {
+	years := p.years(code)
+	if len(years) == 0 {
+		return 0, false
+	}
+	year := timestamp.UTC().Year()
+	idx := sort.Search(len(years), func(i int) bool { return years[i] > year })
+	if idx == 0 {
+		return p[code][years[0]], true
+	}
+	return p[code][years[idx-1]], true
+}
+
+// Latest returns the most recent population figure for each country
+func (p PopulationHistory) Latest() map[string]int64 {
+	latest := make(map[string]int64, len(p))
+	for code := range p {
+		if years := p.years(code); len(years) > 0 {
+			latest[code] = p[code][years[len(years)-1]]
+		}
+	}
+	return latest
+}
+
+func (p PopulationHistory) years(code string) []int {
+	years := make([]int, 0, len(p[code]))
+	for year := range p[code] {
+		years = append(years, year)
+	}
+	sort.Ints(years)
+	return years
+}
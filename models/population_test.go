@@ -0,0 +1,47 @@
+package models_test
+
+import (
+	"github.com/clambin/covid19/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPopulationHistory_Get(t *testing.T) {
+	p := models.PopulationHistory{}
+	p.Add("BE", 2020, 11_500_000)
+	p.Add("BE", 2022, 11_600_000)
+	p.Add("US", 2021, 330_000_000)
+
+	tests := []struct {
+		name      string
+		code      string
+		timestamp time.Time
+		wantFound bool
+		want      int64
+	}{
+		{name: "exact year", code: "BE", timestamp: time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC), wantFound: true, want: 11_500_000},
+		{name: "missing year", code: "BE", timestamp: time.Date(2021, time.June, 1, 0, 0, 0, 0, time.UTC), wantFound: true, want: 11_500_000},
+		{name: "after last year", code: "BE", timestamp: time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC), wantFound: true, want: 11_600_000},
+		{name: "before first year", code: "US", timestamp: time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC), wantFound: true, want: 330_000_000},
+		{name: "new year in utc", code: "BE", timestamp: time.Date(2022, time.January, 1, 0, 30, 0, 0, time.FixedZone("CET", 3600)), wantFound: true, want: 11_500_000},
+		{name: "unknown country", code: "??", timestamp: time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := p.Get(tt.code, tt.timestamp)
+			assert.Equal(t, tt.wantFound, found)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPopulationHistory_Latest(t *testing.T) {
+	p := models.PopulationHistory{}
+	p.Add("BE", 2022, 11_600_000)
+	p.Add("BE", 2020, 11_500_000)
+	p.Add("US", 2021, 330_000_000)
+
+	assert.Equal(t, map[string]int64{"BE": 11_600_000, "US": 330_000_000}, p.Latest())
+}
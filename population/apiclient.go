@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/clambin/covid19/tracing/otelrapidapi"
 	"github.com/clambin/go-rapidapi"
 	"net/url"
 )
@@ -27,7 +28,7 @@ const rapidAPIHost = "world-population.p.rapidapi.com"
 // NewAPIClient creates a new Population API Client
 func NewAPIClient(apiKey string) *RapidAPIClient {
 	return &RapidAPIClient{
-		API: rapidapi.New(rapidAPIHost, apiKey),
+		API: otelrapidapi.New(rapidAPIHost, apiKey),
 	}
 }
 
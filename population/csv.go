@@ -0,0 +1,105 @@
+package population
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"golang.org/x/exp/slog"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CSVImporter imports population figures from a local CSV file, as an alternative to the RapidAPI-based Probe.
+// The file must start with a header row naming (at least) a "code", "year" and "population" column. Codes are
+// two-letter country codes, as used in the covid19 table. Other columns are ignored.
+type CSVImporter struct {
+	Filename string
+	store    Adder
+}
+
+// NewCSVImporter creates a new CSVImporter
+func NewCSVImporter(filename string, store Adder) *CSVImporter {
+	return &CSVImporter{
+		Filename: filename,
+		store:    store,
+	}
+}
+
+// Update reads all population figures from the CSV file and stores them in the database
+func (importer *CSVImporter) Update(ctx context.Context) (int, error) {
+	f, err := os.Open(importer.Filename)
+	if err != nil {
+		return 0, fmt.Errorf("open: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	return importer.Import(ctx, f)
+}
+
+// Import reads all population figures from the provided reader and stores them in the database
+func (importer *CSVImporter) Import(ctx context.Context, r io.Reader) (count int, err error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("header: %w", err)
+	}
+	columns, err := getColumns(header, "code", "year", "population")
+	if err != nil {
+		return 0, fmt.Errorf("header: %w", err)
+	}
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return count, err
+		}
+
+		var record []string
+		if record, err = reader.Read(); errors.Is(err, io.EOF) {
+			return count, nil
+		} else if err != nil {
+			return count, fmt.Errorf("read: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		var (
+			code       = strings.ToUpper(strings.TrimSpace(record[columns["code"]]))
+			year       int
+			population int64
+		)
+		if year, err = strconv.Atoi(strings.TrimSpace(record[columns["year"]])); err != nil {
+			return count, fmt.Errorf("line %d: invalid year: %w", line, err)
+		}
+		if population, err = strconv.ParseInt(strings.TrimSpace(record[columns["population"]]), 10, 64); err != nil {
+			return count, fmt.Errorf("line %d: invalid population: %w", line, err)
+		}
+		if code == "" || population <= 0 {
+			slog.Warn("skipping invalid population record", "line", line, "code", code, "population", population)
+			continue
+		}
+
+		if err = importer.store.Add(ctx, code, year, population); err != nil {
+			return count, fmt.Errorf("add: %w", err)
+		}
+		count++
+	}
+}
+
+func getColumns(header []string, names ...string) (map[string]int, error) {
+	columns := make(map[string]int)
+	for idx, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = idx
+	}
+	result := make(map[string]int)
+	for _, name := range names {
+		idx, ok := columns[name]
+		if !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+		result[name] = idx
+	}
+	return result, nil
+}
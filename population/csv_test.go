@@ -0,0 +1,98 @@
+package population_test
+
+import (
+	"context"
+	population2 "github.com/clambin/covid19/internal/testtools/db/population"
+	"github.com/clambin/covid19/models"
+	"github.com/clambin/covid19/population"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCSVImporter_Update(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "population.csv")
+	err := os.WriteFile(filename, []byte(`Code,Year,Population
+BE,2020,11500000
+BE,2022,11600000
+us,2021,330000000
+`), 0600)
+	require.NoError(t, err)
+
+	store := population2.FakeStore{}
+	importer := population.NewCSVImporter(filename, &store)
+
+	count, err := importer.Update(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, models.PopulationHistory{
+		"BE": {2020: 11500000, 2022: 11600000},
+		"US": {2021: 330000000},
+	}, store.Content)
+}
+
+func TestCSVImporter_Import(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr assert.ErrorAssertionFunc
+		want    int
+	}{
+		{
+			name:    "extra columns",
+			input:   "LocID,Location,Code,Year,Population\n56,Belgium,BE,2020,11500000\n",
+			wantErr: assert.NoError,
+			want:    1,
+		},
+		{
+			name:    "invalid records are skipped",
+			input:   "code,year,population\n,2020,100\nBE,2020,0\nBE,2020,10\n",
+			wantErr: assert.NoError,
+			want:    1,
+		},
+		{
+			name:    "missing column",
+			input:   "code,population\nBE,11500000\n",
+			wantErr: assert.Error,
+		},
+		{
+			name:    "invalid year",
+			input:   "code,year,population\nBE,twenty,11500000\n",
+			wantErr: assert.Error,
+		},
+		{
+			name:    "invalid population",
+			input:   "code,year,population\nBE,2020,many\n",
+			wantErr: assert.Error,
+		},
+		{
+			name:    "empty",
+			input:   "",
+			wantErr: assert.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			importer := population.NewCSVImporter("", &population2.FakeStore{})
+			count, err := importer.Import(context.Background(), strings.NewReader(tt.input))
+			tt.wantErr(t, err)
+			assert.Equal(t, tt.want, count)
+		})
+	}
+}
+
+func TestCSVImporter_Update_Errors(t *testing.T) {
+	importer := population.NewCSVImporter(filepath.Join(t.TempDir(), "missing.csv"), &population2.FakeStore{})
+	_, err := importer.Update(context.Background())
+	assert.Error(t, err)
+
+	filename := filepath.Join(t.TempDir(), "population.csv")
+	require.NoError(t, os.WriteFile(filename, []byte("code,year,population\nBE,2020,10\n"), 0600))
+	importer = population.NewCSVImporter(filename, &population2.FakeStore{Fail: true})
+	_, err = importer.Update(context.Background())
+	assert.Error(t, err)
+}
@@ -2,34 +2,96 @@ package population
 
 import (
 	"context"
+	"fmt"
+	"github.com/clambin/covid19/configuration"
 	"github.com/clambin/covid19/covid"
+	"github.com/clambin/go-common/set"
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/exp/slog"
 	"golang.org/x/sync/semaphore"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Probe downloads the latest population stats per country and stores them in the database
 type Probe struct {
 	APIClient
-	store Adder
+	// MaxConcurrentJobs is the maximum number of countries that are updated in parallel
+	MaxConcurrentJobs int
+	store             Adder
+	updates           *prometheus.CounterVec
+	apiErrors         prometheus.Counter
 }
 
 type Adder interface {
-	Add(string, int64) error
+	Add(context.Context, string, int, int64) error
 }
 
+var _ prometheus.Collector = &Probe{}
+
+// DefaultMaxConcurrentJobs is the default number of countries that are updated in parallel
+const DefaultMaxConcurrentJobs = configuration.DefaultMaxConcurrentJobs
+
 // New creates a new Probe
 func New(apiKey string, store Adder) *Probe {
 	return &Probe{
-		APIClient: NewAPIClient(apiKey),
-		store:     store,
+		APIClient:         NewAPIClient(apiKey),
+		MaxConcurrentJobs: DefaultMaxConcurrentJobs,
+		store:             store,
+		updates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "covid",
+			Subsystem: "population",
+			Name:      "updates_total",
+			Help:      "Number of country population updates, by result",
+		}, []string{"result"}),
+		apiErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "covid",
+			Subsystem: "population",
+			Name:      "api_errors_total",
+			Help:      "Number of failed calls to the population API",
+		}),
+	}
+}
+
+// UpdateError is returned by Update when the population of one or more countries could not be updated
+type UpdateError struct {
+	// Failed contains the error for each country that failed to update
+	Failed map[string]error
+}
+
+func (e *UpdateError) Error() string {
+	countries := make([]string, 0, len(e.Failed))
+	for country := range e.Failed {
+		countries = append(countries, country)
+	}
+	sort.Strings(countries)
+
+	failures := make([]string, len(countries))
+	for idx, country := range countries {
+		failures[idx] = country + ": " + e.Failed[country].Error()
 	}
+	return fmt.Sprintf("failed to update %d countries: %s", len(countries), strings.Join(failures, ", "))
 }
 
-const maxConcurrentJobs = 5
+// Update gets the current population for each supported country and stores it in the database. It returns the number
+// of updated countries. If one or more countries fail to update, the remaining countries are still updated and
+// Update returns an UpdateError listing the failed countries.
+func (probe *Probe) Update(ctx context.Context) (int, error) {
+	maxConcurrentJobs := probe.MaxConcurrentJobs
+	if maxConcurrentJobs <= 0 {
+		maxConcurrentJobs = DefaultMaxConcurrentJobs
+	}
+	maxJobs := semaphore.NewWeighted(int64(maxConcurrentJobs))
+
+	var (
+		wg     sync.WaitGroup
+		lock   sync.Mutex
+		count  int
+		failed = make(map[string]error)
+	)
 
-// Update gets the current population for each supported country and stores it in the database
-func (probe *Probe) Update(ctx context.Context) (count int, err error) {
-	maxJobs := semaphore.NewWeighted(maxConcurrentJobs)
 	for _, code := range countryCodes() {
 		country, found := countryNames[code]
 
@@ -38,39 +100,79 @@ func (probe *Probe) Update(ctx context.Context) (count int, err error) {
 			continue
 		}
 
-		count++
-
-		_ = maxJobs.Acquire(ctx, 1)
-		go func(ctx context.Context, code, country string) {
-			localError := probe.update(ctx, code, country)
-
-			if localError != nil {
-				slog.Error("failed to update population stats", "err", localError, "country", countryNames)
+		// Acquire may succeed on a cancelled context, so check the context explicitly
+		if ctx.Err() != nil || maxJobs.Acquire(ctx, 1) != nil {
+			break
+		}
+		wg.Add(1)
+		go func(code, country string) {
+			defer func() {
+				maxJobs.Release(1)
+				wg.Done()
+			}()
+
+			updated, err := probe.update(ctx, code, country)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				slog.Error("failed to update population stats", "err", err, "country", country)
+				failed[country] = err
+				probe.updates.WithLabelValues("failure").Inc()
+				return
 			}
-
-			maxJobs.Release(1)
-		}(ctx, code, country)
+			if updated {
+				count++
+				probe.updates.WithLabelValues("success").Inc()
+			}
+		}(code, country)
 	}
 
-	_ = maxJobs.Acquire(ctx, maxConcurrentJobs)
+	wg.Wait()
 
-	return count, err
+	if err := ctx.Err(); err != nil {
+		return count, err
+	}
+	if len(failed) > 0 {
+		return count, &UpdateError{Failed: failed}
+	}
+	return count, nil
 }
 
-func countryCodes() (codes []string) {
+func countryCodes() []string {
+	codes := set.Create[string]()
 	for _, code := range covid.CountryCodes {
-		codes = append(codes, code)
+		codes.Add(code)
 	}
-	return
+	return codes.List()
 }
 
-func (probe *Probe) update(ctx context.Context, code, country string) (err error) {
-	var population int64
-	population, err = probe.APIClient.GetPopulation(ctx, country)
+func (probe *Probe) update(ctx context.Context, code, country string) (bool, error) {
+	population, err := probe.APIClient.GetPopulation(ctx, country)
+	if err != nil {
+		probe.apiErrors.Inc()
+		return false, err
+	}
+	if population <= 0 {
+		return false, nil
+	}
 
-	if err == nil && population > 0 {
-		slog.Debug("found population", "country", country, "population", population)
-		err = probe.store.Add(code, population)
+	slog.Debug("found population", "country", country, "population", population)
+	// the API only reports the current population, so record it for the current year
+	if err = probe.store.Add(ctx, code, time.Now().UTC().Year(), population); err != nil {
+		return false, fmt.Errorf("add: %w", err)
 	}
-	return
+	return true, nil
+}
+
+// Describe implements the prometheus.Collector interface
+func (probe *Probe) Describe(descs chan<- *prometheus.Desc) {
+	probe.updates.Describe(descs)
+	probe.apiErrors.Describe(descs)
+}
+
+// Collect implements the prometheus.Collector interface
+func (probe *Probe) Collect(metrics chan<- prometheus.Metric) {
+	probe.updates.Collect(metrics)
+	probe.apiErrors.Collect(metrics)
 }
@@ -2,12 +2,15 @@ package population_test
 
 import (
 	"context"
+	"errors"
 	population2 "github.com/clambin/covid19/internal/testtools/db/population"
 	"github.com/clambin/covid19/population"
 	probeMock "github.com/clambin/covid19/population/mocks"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"strings"
 	"testing"
 )
 
@@ -22,12 +25,85 @@ func TestProbe_Update(t *testing.T) {
 	apiClient.On("GetPopulation", mock.Anything, "Belgium").Return(int64(11), nil)
 	apiClient.On("GetPopulation", mock.Anything, mock.AnythingOfType("string")).Return(int64(0), nil)
 
-	_, err := p.Update(context.Background())
+	count, err := p.Update(context.Background())
 	require.NoError(t, err)
+	assert.Equal(t, 2, count)
 
-	result, _ := store.List()
+	result, _ := store.List(context.Background())
 	assert.Equal(t, map[string]int64{
 		"US": 330,
 		"BE": 11,
 	}, result)
+
+	assert.NoError(t, testutil.CollectAndCompare(p, strings.NewReader(`
+# HELP covid_population_api_errors_total Number of failed calls to the population API
+# TYPE covid_population_api_errors_total counter
+covid_population_api_errors_total 0
+# HELP covid_population_updates_total Number of country population updates, by result
+# TYPE covid_population_updates_total counter
+covid_population_updates_total{result="success"} 2
+`)))
+}
+
+func TestProbe_Update_Failures(t *testing.T) {
+	store := &population2.FakeStore{}
+	apiClient := probeMock.NewAPIClient(t)
+
+	p := population.New("1234", store)
+	p.APIClient = apiClient
+	p.MaxConcurrentJobs = 1
+
+	apiClient.On("GetPopulation", mock.Anything, "United States").Return(int64(330), nil)
+	apiClient.On("GetPopulation", mock.Anything, "Belgium").Return(int64(0), errors.New("fail"))
+	apiClient.On("GetPopulation", mock.Anything, "France").Return(int64(0), errors.New("fail"))
+	apiClient.On("GetPopulation", mock.Anything, mock.AnythingOfType("string")).Return(int64(0), nil)
+
+	count, err := p.Update(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, 1, count)
+
+	var updateErr *population.UpdateError
+	require.ErrorAs(t, err, &updateErr)
+	assert.Len(t, updateErr.Failed, 2)
+	assert.Equal(t, "failed to update 2 countries: Belgium: fail, France: fail", err.Error())
+
+	result, _ := store.List(context.Background())
+	assert.Equal(t, map[string]int64{"US": 330}, result)
+
+	assert.NoError(t, testutil.CollectAndCompare(p, strings.NewReader(`
+# HELP covid_population_api_errors_total Number of failed calls to the population API
+# TYPE covid_population_api_errors_total counter
+covid_population_api_errors_total 2
+# HELP covid_population_updates_total Number of country population updates, by result
+# TYPE covid_population_updates_total counter
+covid_population_updates_total{result="failure"} 2
+covid_population_updates_total{result="success"} 1
+`)))
+}
+
+func TestProbe_Update_StoreFailure(t *testing.T) {
+	apiClient := probeMock.NewAPIClient(t)
+
+	p := population.New("1234", &population2.FakeStore{Fail: true})
+	p.APIClient = apiClient
+
+	apiClient.On("GetPopulation", mock.Anything, "Belgium").Return(int64(11), nil)
+	apiClient.On("GetPopulation", mock.Anything, mock.AnythingOfType("string")).Return(int64(0), nil)
+
+	count, err := p.Update(context.Background())
+	require.Error(t, err)
+	assert.Zero(t, count)
+	assert.Contains(t, err.Error(), "Belgium: add: db error")
+}
+
+func TestProbe_Update_Cancelled(t *testing.T) {
+	p := population.New("1234", &population2.FakeStore{})
+	p.APIClient = probeMock.NewAPIClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	count, err := p.Update(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, count)
 }
@@ -20,7 +20,7 @@ type ByCountryHandler struct {
 }
 
 type CovidGetter interface {
-	GetLatestForCountries(time time.Time) (map[string]models.CountryEntry, error)
+	GetLatestForCountries(ctx context.Context, time time.Time) (map[string]models.CountryEntry, error)
 }
 
 var _ simplejson.Handler = &ByCountryHandler{}
@@ -31,9 +31,9 @@ func (handler *ByCountryHandler) Endpoints() (endpoints simplejson.Endpoints) {
 	}
 }
 
-func (handler *ByCountryHandler) tableQuery(_ context.Context, req simplejson.QueryRequest) (response simplejson.Response, err error) {
+func (handler *ByCountryHandler) tableQuery(ctx context.Context, req simplejson.QueryRequest) (response simplejson.Response, err error) {
 	var d *data.Table
-	d, err = getStatsByCountry(handler.DB, req.QueryArgs, handler.Mode)
+	d, err = getStatsByCountry(ctx, handler.DB, req.QueryArgs, handler.Mode)
 	if err != nil {
 		return
 	}
@@ -3,6 +3,7 @@ package countries
 import (
 	"context"
 	"github.com/clambin/covid19/covid"
+	"github.com/clambin/covid19/models"
 	"github.com/clambin/simplejson/v6"
 	"time"
 )
@@ -15,7 +16,7 @@ type ByCountryByPopulationHandler struct {
 }
 
 type PopulationGetter interface {
-	List() (map[string]int64, error)
+	ListByYear(ctx context.Context) (models.PopulationHistory, error)
 }
 
 var _ simplejson.Handler = &ByCountryHandler{}
@@ -26,14 +27,14 @@ func (handler *ByCountryByPopulationHandler) Endpoints() (endpoints simplejson.E
 	}
 }
 
-func (handler *ByCountryByPopulationHandler) tableQuery(_ context.Context, req simplejson.QueryRequest) (simplejson.Response, error) {
-	d, err := getStatsByCountry(handler.CovidDB, req.QueryArgs, handler.Mode)
+func (handler *ByCountryByPopulationHandler) tableQuery(ctx context.Context, req simplejson.QueryRequest) (simplejson.Response, error) {
+	d, err := getStatsByCountry(ctx, handler.CovidDB, req.QueryArgs, handler.Mode)
 	if err != nil {
 		return nil, err
 	}
 
-	var population map[string]int64
-	if population, err = handler.PopDB.List(); err != nil {
+	var population models.PopulationHistory
+	if population, err = handler.PopDB.ListByYear(ctx); err != nil {
 		return nil, err
 	}
 
@@ -61,7 +62,7 @@ func (handler *ByCountryByPopulationHandler) tableQuery(_ context.Context, req s
 
 		for index, value := range values {
 			var rate float64
-			if pop, popFound := population[code]; popFound {
+			if pop, popFound := population.Get(code, ts[index]); popFound {
 				rate = value / float64(pop)
 			}
 
@@ -20,8 +20,8 @@ func TestConfirmedByCountryByPopulation(t *testing.T) {
 	}}
 
 	db2 := population.FakeStore{}
-	_ = db2.Add("BE", 10)
-	_ = db2.Add("US", 20)
+	_ = db2.Add(context.Background(), "BE", 2020, 10)
+	_ = db2.Add(context.Background(), "US", 2020, 20)
 
 	h := countries.ByCountryByPopulationHandler{
 		CovidDB: &db,
@@ -48,8 +48,8 @@ func TestDeathsByCountryByPopulation(t *testing.T) {
 	}}
 
 	db2 := population.FakeStore{}
-	_ = db2.Add("BE", 10)
-	_ = db2.Add("US", 20)
+	_ = db2.Add(context.Background(), "BE", 2020, 10)
+	_ = db2.Add(context.Background(), "US", 2020, 20)
 
 	h := countries.ByCountryByPopulationHandler{
 		CovidDB: &db,
@@ -69,6 +69,41 @@ func TestDeathsByCountryByPopulation(t *testing.T) {
 	}}, response)
 }
 
+func TestConfirmedByCountryByPopulation_ByYear(t *testing.T) {
+	db := covid2.FakeStore{Records: []models.CountryEntry{
+		{Timestamp: time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC), Name: "Belgium", Code: "BE", Confirmed: 200},
+		{Timestamp: time.Date(2022, 1, 3, 0, 0, 0, 0, time.UTC), Name: "Belgium", Code: "BE", Confirmed: 400},
+	}}
+
+	db2 := population.FakeStore{}
+	_ = db2.Add(context.Background(), "BE", 2019, 10)
+	_ = db2.Add(context.Background(), "BE", 2022, 40)
+
+	h := countries.ByCountryByPopulationHandler{
+		CovidDB: &db,
+		PopDB:   &db2,
+		Mode:    countries.CountryConfirmed,
+	}
+
+	ctx := context.Background()
+	for _, tt := range []struct {
+		timestamp time.Time
+		want      float64
+	}{
+		{timestamp: time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC), want: 20},
+		{timestamp: time.Date(2022, 1, 3, 0, 0, 0, 0, time.UTC), want: 10},
+	} {
+		args := simplejson.QueryArgs{Args: simplejson.Args{Range: simplejson.Range{To: tt.timestamp}}}
+		response, err := h.Endpoints().Query(ctx, simplejson.QueryRequest{QueryArgs: args})
+		require.NoError(t, err)
+		assert.Equal(t, &simplejson.TableResponse{Columns: []simplejson.Column{
+			{Text: "timestamp", Data: simplejson.TimeColumn{tt.timestamp}},
+			{Text: "country", Data: simplejson.StringColumn{"BE"}},
+			{Text: "confirmed", Data: simplejson.NumberColumn{tt.want}},
+		}}, response)
+	}
+}
+
 func TestConfirmedByCountryByPopulation_Errors(t *testing.T) {
 	db := covid2.FakeStore{Records: []models.CountryEntry{
 		{Timestamp: time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC), Name: "Belgium", Code: "BE", Confirmed: 200},
@@ -1,6 +1,7 @@
 package countries
 
 import (
+	"context"
 	"fmt"
 	"github.com/clambin/simplejson/v6"
 	"github.com/clambin/simplejson/v6/pkg/data"
@@ -8,8 +9,8 @@ import (
 	"time"
 )
 
-func getStatsByCountry(db CovidGetter, args simplejson.QueryArgs, mode int) (*data.Table, error) {
-	entries, err := db.GetLatestForCountries(args.Range.To)
+func getStatsByCountry(ctx context.Context, db CovidGetter, args simplejson.QueryArgs, mode int) (*data.Table, error) {
+	entries, err := db.GetLatestForCountries(ctx, args.Range.To)
 	if err != nil {
 		return nil, fmt.Errorf("database: %w", err)
 	}
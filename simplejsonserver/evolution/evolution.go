@@ -17,7 +17,7 @@ type Handler struct {
 }
 
 type CovidGetter interface {
-	GetAllForRange(time.Time, time.Time) ([]models.CountryEntry, error)
+	GetDailyForRange(context.Context, time.Time, time.Time) ([]models.DailyEntry, error)
 }
 
 var _ simplejson.Handler = &Handler{}
@@ -28,29 +28,28 @@ func (handler *Handler) Endpoints() (endpoints simplejson.Endpoints) {
 	}
 }
 
-func (handler *Handler) tableQuery(_ context.Context, req simplejson.QueryRequest) (simplejson.Response, error) {
+// tableQuery returns the average increase for each country on the last day of the range. Like the daily views it reads
+// from, the range selects report dates: the figures for the last day of the range are published the day after.
+func (handler *Handler) tableQuery(ctx context.Context, req simplejson.QueryRequest) (simplejson.Response, error) {
 	end := req.Args.Range.To
 	if end.IsZero() {
 		end = time.Now()
 	}
 
-	entries, err := handler.CovidDB.GetAllForRange(end.Add(-Window*24*time.Hour), end)
+	entries, err := handler.CovidDB.GetDailyForRange(ctx, end.Add(-Window*24*time.Hour), end)
 	if err != nil {
 		return nil, err
 	}
 
+	increases := getLatestAverages(entries)
+	names := getSortedCountryNames(increases)
+
 	var (
 		timestamps []time.Time
-		names      []string
 		values     []float64
 	)
 
-	if len(entries) > 0 {
-		start := entries[len(entries)-1].Timestamp.Add(-Window * 24 * time.Hour)
-
-		increases := processEntries(entries, start)
-		names = getSortedCountryNames(increases)
-
+	if len(names) > 0 {
 		timestamps = make([]time.Time, len(names))
 		values = make([]float64, len(names))
 
@@ -78,58 +77,12 @@ func getSortedCountryNames(averages map[string]float64) (names []string) {
 	return
 }
 
-func processEntries(entries []models.CountryEntry, start time.Time) (output map[string]float64) {
-	summary := summarizeEntries(entries, start)
-
+// getLatestAverages returns the most recent 7-day average increase for each country. Entries are sorted by timestamp,
+// so later entries overwrite earlier ones
+func getLatestAverages(entries []models.DailyEntry) (output map[string]float64) {
 	output = make(map[string]float64)
-	for key, entry := range summary {
-		output[key] = entry.increase()
+	for _, entry := range entries {
+		output[entry.Code] = entry.ConfirmedAverage
 	}
 	return
 }
-
-func summarizeEntries(entries []models.CountryEntry, start time.Time) (summary map[string]*evolution) {
-	summary = make(map[string]*evolution)
-	for i := 0; i < len(entries); i++ {
-		if entries[i].Timestamp.Before(start) {
-			continue
-		}
-		current, ok := summary[entries[i].Code]
-		if !ok {
-			current = &evolution{}
-			summary[entries[i].Code] = current
-		}
-		current.process(entries[i])
-		//summary[entries[i].Code] = current
-	}
-	return
-}
-
-type evolution struct {
-	first evolutionEntry
-	last  evolutionEntry
-}
-
-func (e *evolution) process(entry models.CountryEntry) {
-	if e.first.timestamp.IsZero() {
-		e.first.timestamp = entry.Timestamp
-		e.first.value = entry.Confirmed
-	} else {
-		e.last.timestamp = entry.Timestamp
-		e.last.value = entry.Confirmed
-	}
-}
-
-func (e *evolution) increase() float64 {
-	if e.first.timestamp.IsZero() || e.last.timestamp.IsZero() {
-		return 0
-	}
-	days := float64(e.last.timestamp.Sub(e.first.timestamp).Hours()) / 24.0
-
-	return float64(e.last.value-e.first.value) / days
-}
-
-type evolutionEntry struct {
-	timestamp time.Time
-	value     int64
-}
@@ -21,13 +21,38 @@ func TestEvolution(t *testing.T) {
 
 	response, err := h.Endpoints().Query(ctx, simplejson.QueryRequest{QueryArgs: args})
 	require.NoError(t, err)
+	// B: from 3 (report date 1 Jan) to 20 (report date 4 Jan) in 3 days. See TestEvolution_ReportDates
 	assert.Equal(t, &simplejson.TableResponse{Columns: []simplejson.Column{
 		{Text: "timestamp", Data: simplejson.TimeColumn{time.Date(2022, time.January, 4, 0, 0, 0, 0, time.UTC), time.Date(2022, time.January, 4, 0, 0, 0, 0, time.UTC)}},
 		{Text: "country", Data: simplejson.StringColumn{"A", "B"}},
-		{Text: "increase", Data: simplejson.NumberColumn{2, 3.5}},
+		{Text: "increase", Data: simplejson.NumberColumn{2, 17.0 / 3}},
 	}}, response)
 }
 
+// TestEvolution_ReportDates shows that the range selects report dates: figures published on 5 January belong to
+// 4 January, so they are included in a range that ends on 4 January, but not in one that ends on 3 January.
+func TestEvolution_ReportDates(t *testing.T) {
+	h := evolution.Handler{CovidDB: &covid2.FakeStore{Records: []models.CountryEntry{
+		{Timestamp: time.Date(2022, time.January, 2, 0, 0, 0, 0, time.UTC), Code: "B", Name: "B", Confirmed: 3},
+		{Timestamp: time.Date(2022, time.January, 4, 0, 0, 0, 0, time.UTC), Code: "B", Name: "B", Confirmed: 10},
+		{Timestamp: time.Date(2022, time.January, 5, 0, 0, 0, 0, time.UTC), Code: "B", Name: "B", Confirmed: 20},
+	}}}
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		to   time.Time
+		want float64
+	}{
+		{to: time.Date(2022, time.January, 4, 0, 0, 0, 0, time.UTC), want: 17.0 / 3},
+		{to: time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC), want: 3.5},
+	} {
+		args := simplejson.QueryArgs{Args: simplejson.Args{Range: simplejson.Range{To: tt.to}}}
+		response, err := h.Endpoints().Query(ctx, simplejson.QueryRequest{QueryArgs: args})
+		require.NoError(t, err)
+		assert.Equal(t, simplejson.NumberColumn{tt.want}, response.(*simplejson.TableResponse).Columns[2].Data, tt.to)
+	}
+}
+
 func TestEvolution_NoEndDate(t *testing.T) {
 	db := covid2.FakeStore{Records: dbContents}
 	h := evolution.Handler{CovidDB: &db}
@@ -59,11 +84,11 @@ func TestEvolution_NoData(t *testing.T) {
 }
 
 func BenchmarkHandler_TableQuery_Evolution(b *testing.B) {
-	var bigData []models.CountryEntry
+	var bigData []models.DailyEntry
 	timestamp := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
 	for i := 0; i < 2*365; i++ {
 		for name, code := range covid.CountryCodes {
-			bigData = append(bigData, models.CountryEntry{
+			bigData = append(bigData, models.DailyEntry{
 				Timestamp: timestamp,
 				Code:      code,
 				Name:      name,
@@ -87,10 +112,10 @@ func BenchmarkHandler_TableQuery_Evolution(b *testing.B) {
 }
 
 type stubbedStore struct {
-	records []models.CountryEntry
+	records []models.DailyEntry
 }
 
-func (s stubbedStore) GetAllForRange(_, _ time.Time) ([]models.CountryEntry, error) {
+func (s stubbedStore) GetDailyForRange(_ context.Context, _, _ time.Time) ([]models.DailyEntry, error) {
 	return s.records, nil
 }
 
@@ -15,7 +15,7 @@ type Handler struct {
 }
 
 type CovidGetter interface {
-	GetLatestForCountries(time2 time.Time) (map[string]models.CountryEntry, error)
+	GetLatestForCountries(ctx context.Context, time time.Time) (map[string]models.CountryEntry, error)
 }
 
 var _ simplejson.Handler = &Handler{}
@@ -26,8 +26,8 @@ func (handler *Handler) Endpoints() (endpoints simplejson.Endpoints) {
 	}
 }
 
-func (handler *Handler) tableQuery(_ context.Context, req simplejson.QueryRequest) (simplejson.Response, error) {
-	entries, err := handler.CovidDB.GetLatestForCountries(req.Args.Range.To)
+func (handler *Handler) tableQuery(ctx context.Context, req simplejson.QueryRequest) (simplejson.Response, error) {
+	entries, err := handler.CovidDB.GetLatestForCountries(ctx, req.Args.Range.To)
 	if err != nil {
 		return nil, fmt.Errorf("database: %w", err)
 	}
@@ -14,7 +14,7 @@ import (
 
 func TestHandler(t *testing.T) {
 	db := covid.FakeStore{}
-	_ = db.Add(
+	_ = db.Add(context.Background(),
 		[]models.CountryEntry{
 			{
 				Timestamp: time.Date(2021, 12, 17, 0, 0, 0, 0, time.UTC),
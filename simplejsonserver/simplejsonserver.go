@@ -59,6 +59,10 @@ func New(covidDB CovidGetter, popDB PopulationGetter) *simplejson.Server {
 		},
 	}
 
+	for target, handler := range handlers {
+		handlers[target] = tracedHandler{Handler: handler, target: target}
+	}
+
 	return simplejson.New(handlers,
 		simplejson.WithQueryMetrics{Name: "covid19"},
 		simplejson.WithHTTPMetrics{Option: middleware.PrometheusMetricsOptions{
@@ -7,6 +7,11 @@ import (
 	"github.com/clambin/covid19/simplejsonserver"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -24,9 +29,9 @@ func TestServer(t *testing.T) {
 		{Timestamp: time.Date(2022, time.January, 18, 0, 0, 0, 0, time.UTC), Code: "B", Name: "B"},
 		{Timestamp: time.Date(2022, time.January, 19, 0, 0, 0, 0, time.UTC), Code: "B", Name: "B", Confirmed: 10, Deaths: 5},
 	}}
-	popDB := population.FakeStore{Content: map[string]int64{
-		"A": 10,
-		"B": 100,
+	popDB := population.FakeStore{Content: models.PopulationHistory{
+		"A": {2022: 10},
+		"B": {2022: 100},
 	}}
 	s := simplejsonserver.New(&covidDB, &popDB)
 
@@ -79,25 +84,25 @@ func TestServer(t *testing.T) {
 		{
 			name:  "incremental",
 			input: `{"targets": [{"target": "incremental","type": "table"}],"range": {"to": "2022-01-20T00:00:00Z"}}`,
-			output: `[{"type":"table","columns":[{"text":"timestamp","type":"time"},{"text":"confirmed","type":"number"},{"text":"deaths","type":"number"}],"rows":[["2022-01-18T00:00:00Z",0,0],["2022-01-19T00:00:00Z",14,6]]}]
+			output: `[{"type":"table","columns":[{"text":"timestamp","type":"time"},{"text":"confirmed","type":"number"},{"text":"deaths","type":"number"}],"rows":[["2022-01-17T00:00:00Z",0,0],["2022-01-18T00:00:00Z",14,6]]}]
 `,
 		},
 		{
 			name:  "incremental (filtered)",
 			input: `{"targets": [{"target": "incremental","type": "table"}],"range": {"to": "2022-01-20T00:00:00Z"},"adhocFilters": [{"key": "Country Name","operator": "=","value": "A"}]}`,
-			output: `[{"type":"table","columns":[{"text":"timestamp","type":"time"},{"text":"confirmed","type":"number"},{"text":"deaths","type":"number"}],"rows":[["2022-01-18T00:00:00Z",0,0],["2022-01-19T00:00:00Z",4,1]]}]
+			output: `[{"type":"table","columns":[{"text":"timestamp","type":"time"},{"text":"confirmed","type":"number"},{"text":"deaths","type":"number"}],"rows":[["2022-01-17T00:00:00Z",0,0],["2022-01-18T00:00:00Z",4,1]]}]
 `,
 		},
 		{
 			name:  "cumulative",
 			input: `{"targets": [{"target": "cumulative","type": "table"}],"range": {"to": "2022-01-20T00:00:00Z"}}`,
-			output: `[{"type":"table","columns":[{"text":"timestamp","type":"time"},{"text":"confirmed","type":"number"},{"text":"deaths","type":"number"}],"rows":[["2022-01-18T00:00:00Z",0,0],["2022-01-19T00:00:00Z",14,6]]}]
+			output: `[{"type":"table","columns":[{"text":"timestamp","type":"time"},{"text":"confirmed","type":"number"},{"text":"deaths","type":"number"}],"rows":[["2022-01-17T00:00:00Z",0,0],["2022-01-18T00:00:00Z",14,6]]}]
 `,
 		},
 		{
 			name:  "cumulative (filtered)",
 			input: `{"targets": [{"target": "cumulative","type": "table"}],"range": {"to": "2022-01-20T00:00:00Z"},"adhocFilters": [{"key": "Country Name","operator": "=","value": "A"}]}`,
-			output: `[{"type":"table","columns":[{"text":"timestamp","type":"time"},{"text":"confirmed","type":"number"},{"text":"deaths","type":"number"}],"rows":[["2022-01-18T00:00:00Z",0,0],["2022-01-19T00:00:00Z",4,1]]}]
+			output: `[{"type":"table","columns":[{"text":"timestamp","type":"time"},{"text":"confirmed","type":"number"},{"text":"deaths","type":"number"}],"rows":[["2022-01-17T00:00:00Z",0,0],["2022-01-18T00:00:00Z",4,1]]}]
 `,
 		},
 		{
@@ -132,3 +137,20 @@ func TestServer(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	s := simplejsonserver.New(&covid.FakeStore{Fail: true}, &population.FakeStore{})
+	req, _ := http.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"targets": [{"target": "cumulative","type": "table"}],"range": {"to": "2022-01-20T00:00:00Z"}}`))
+	resp := httptest.NewRecorder()
+	s.Query(resp, req)
+	require.NotEqual(t, http.StatusOK, resp.Code)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "query cumulative", spans[0].Name())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+}
@@ -22,8 +22,8 @@ func (handler *CumulativeHandler) Endpoints() (endpoints simplejson.Endpoints) {
 	}
 }
 
-func (handler *CumulativeHandler) tableQuery(_ context.Context, req simplejson.QueryRequest) (simplejson.Response, error) {
-	entries, err := handler.Fetcher.getTotals(req.QueryArgs)
+func (handler *CumulativeHandler) tableQuery(ctx context.Context, req simplejson.QueryRequest) (simplejson.Response, error) {
+	entries, err := handler.Fetcher.getTotals(ctx, req.QueryArgs)
 	if err != nil {
 		return nil, err
 	}
@@ -34,10 +34,10 @@ func (handler *CumulativeHandler) tagKeys(_ context.Context) []string {
 	return []string{"Country Name"}
 }
 
-func (handler *CumulativeHandler) tagValues(_ context.Context, key string) (values []string, err error) {
+func (handler *CumulativeHandler) tagValues(ctx context.Context, key string) (values []string, err error) {
 	if key != "Country Name" {
 		return values, fmt.Errorf("unsupported tag '%s'", key)
 	}
 
-	return handler.Fetcher.DB.GetAllCountryNames()
+	return handler.Fetcher.DB.GetAllCountryNames(ctx)
 }
@@ -25,10 +25,10 @@ func TestCumulativeHandler_Global(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, &simplejson.TableResponse{Columns: []simplejson.Column{
 		{Text: "timestamp", Data: simplejson.TimeColumn{
+			time.Date(2020, time.October, 31, 0, 0, 0, 0, time.UTC),
 			time.Date(2020, time.November, 1, 0, 0, 0, 0, time.UTC),
 			time.Date(2020, time.November, 2, 0, 0, 0, 0, time.UTC),
 			time.Date(2020, time.November, 3, 0, 0, 0, 0, time.UTC),
-			time.Date(2020, time.November, 4, 0, 0, 0, 0, time.UTC),
 		}},
 		{Text: "confirmed", Data: simplejson.NumberColumn{1, 3, 3, 10}},
 		{Text: "deaths", Data: simplejson.NumberColumn{0, 0, 0, 1}},
@@ -81,7 +81,7 @@ func TestCumulativeHandler_Country(t *testing.T) {
 	response, err := h.Endpoints().Query(ctx, simplejson.QueryRequest{QueryArgs: args})
 	require.NoError(t, err)
 	assert.Equal(t, &simplejson.TableResponse{Columns: []simplejson.Column{
-		{Text: "timestamp", Data: simplejson.TimeColumn{time.Date(2020, time.November, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, time.November, 2, 0, 0, 0, 0, time.UTC)}},
+		{Text: "timestamp", Data: simplejson.TimeColumn{time.Date(2020, time.October, 31, 0, 0, 0, 0, time.UTC), time.Date(2020, time.November, 1, 0, 0, 0, 0, time.UTC)}},
 		{Text: "confirmed", Data: simplejson.NumberColumn{1, 3}},
 		{Text: "deaths", Data: simplejson.NumberColumn{0, 0}},
 	}}, response)
@@ -170,12 +170,12 @@ var (
 var _ summarized.CovidGetter = stubbedStore{}
 
 type stubbedStore struct {
-	allForCountry map[string][]models.CountryEntry
+	allForCountry map[string][]models.DailyEntry
 	countryNames  []string
-	totalsPerDay  []models.CountryEntry
+	totalsPerDay  []models.DailyEntry
 }
 
-func (s stubbedStore) GetAllForCountryName(s2 string) ([]models.CountryEntry, error) {
+func (s stubbedStore) GetDailyForCountryName(_ context.Context, s2 string) ([]models.DailyEntry, error) {
 	results, ok := s.allForCountry[s2]
 	if !ok {
 		return nil, fmt.Errorf("invalid country: %s", s2)
@@ -183,30 +183,30 @@ func (s stubbedStore) GetAllForCountryName(s2 string) ([]models.CountryEntry, er
 	return results, nil
 }
 
-func (s stubbedStore) GetAllCountryNames() ([]string, error) {
+func (s stubbedStore) GetAllCountryNames(_ context.Context) ([]string, error) {
 	return s.countryNames, nil
 }
 
-func (s stubbedStore) GetTotalsPerDay() ([]models.CountryEntry, error) {
+func (s stubbedStore) GetTotalsPerDay(_ context.Context) ([]models.DailyEntry, error) {
 	return s.totalsPerDay, nil
 }
 
 func buildBigDatabase(from, to time.Time) stubbedStore {
-	allForCountry := make(map[string][]models.CountryEntry)
+	allForCountry := make(map[string][]models.DailyEntry)
 	countryNames := make([]string, 0, 193)
-	var totalsForDay []models.CountryEntry
+	var totalsForDay []models.DailyEntry
 
 	for country := 0; country < 193; country++ {
-		content := make([]models.CountryEntry, 0, 193)
+		content := make([]models.DailyEntry, 0, 193)
 		countryName := strconv.Itoa(country)
 		for timestamp := from; !timestamp.After(to); timestamp = timestamp.Add(24 * time.Hour) {
-			content = append(content, models.CountryEntry{
+			content = append(content, models.DailyEntry{
 				Timestamp: timestamp,
 				Code:      countryName,
 				Name:      countryName,
 			})
 			if country == 0 {
-				totalsForDay = append(totalsForDay, models.CountryEntry{Timestamp: timestamp})
+				totalsForDay = append(totalsForDay, models.DailyEntry{Timestamp: timestamp})
 			}
 		}
 		allForCountry[countryName] = content
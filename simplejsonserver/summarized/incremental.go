@@ -22,22 +22,22 @@ func (handler IncrementalHandler) Endpoints() (endpoints simplejson.Endpoints) {
 	}
 }
 
-func (handler *IncrementalHandler) tableQuery(_ context.Context, req simplejson.QueryRequest) (simplejson.Response, error) {
-	entries, err := handler.Fetcher.getTotals(req.QueryArgs)
+func (handler *IncrementalHandler) tableQuery(ctx context.Context, req simplejson.QueryRequest) (simplejson.Response, error) {
+	entries, err := handler.Fetcher.getTotals(ctx, req.QueryArgs)
 	if err != nil {
 		return nil, err
 	}
-	return createDeltas(dbEntriesToTable(entries)).Filter(req.Args).CreateTableResponse(), nil
+	return dbEntriesToDeltasTable(entries).Filter(req.Args).CreateTableResponse(), nil
 }
 
 func (handler *IncrementalHandler) tagKeys(_ context.Context) []string {
 	return []string{"Country Name"}
 }
 
-func (handler *IncrementalHandler) tagValues(_ context.Context, key string) (values []string, err error) {
+func (handler *IncrementalHandler) tagValues(ctx context.Context, key string) (values []string, err error) {
 	if key != "Country Name" {
 		return values, fmt.Errorf("unsupported tag '%s'", key)
 	}
 
-	return handler.Fetcher.DB.GetAllCountryNames()
+	return handler.Fetcher.DB.GetAllCountryNames(ctx)
 }
@@ -23,10 +23,10 @@ func TestIncrementalHandler_Global(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, &simplejson.TableResponse{Columns: []simplejson.Column{
 		{Text: "timestamp", Data: simplejson.TimeColumn{
+			time.Date(2020, time.October, 31, 0, 0, 0, 0, time.UTC),
 			time.Date(2020, time.November, 1, 0, 0, 0, 0, time.UTC),
 			time.Date(2020, time.November, 2, 0, 0, 0, 0, time.UTC),
 			time.Date(2020, time.November, 3, 0, 0, 0, 0, time.UTC),
-			time.Date(2020, time.November, 4, 0, 0, 0, 0, time.UTC),
 		}},
 		{Text: "confirmed", Data: simplejson.NumberColumn{1, 2, 0, 7}},
 		{Text: "deaths", Data: simplejson.NumberColumn{0, 0, 0, 1}},
@@ -57,7 +57,7 @@ func TestIncrementalHandler_Country(t *testing.T) {
 	response, err := h.Endpoints().Query(ctx, simplejson.QueryRequest{QueryArgs: args})
 	require.NoError(t, err)
 	assert.Equal(t, &simplejson.TableResponse{Columns: []simplejson.Column{
-		{Text: "timestamp", Data: simplejson.TimeColumn{time.Date(2020, time.November, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, time.November, 2, 0, 0, 0, 0, time.UTC)}},
+		{Text: "timestamp", Data: simplejson.TimeColumn{time.Date(2020, time.October, 31, 0, 0, 0, 0, time.UTC), time.Date(2020, time.November, 1, 0, 0, 0, 0, time.UTC)}},
 		{Text: "confirmed", Data: simplejson.NumberColumn{1, 2}},
 		{Text: "deaths", Data: simplejson.NumberColumn{0, 0}},
 	}}, response)
@@ -1,6 +1,7 @@
 package summarized
 
 import (
+	"context"
 	"github.com/clambin/covid19/models"
 	"github.com/clambin/simplejson/v6"
 	"github.com/clambin/simplejson/v6/pkg/data"
@@ -12,14 +13,14 @@ type Fetcher struct {
 }
 
 type CovidGetter interface {
-	GetAllForCountryName(string) ([]models.CountryEntry, error)
-	GetAllCountryNames() ([]string, error)
-	GetTotalsPerDay() ([]models.CountryEntry, error)
+	GetDailyForCountryName(context.Context, string) ([]models.DailyEntry, error)
+	GetAllCountryNames(context.Context) ([]string, error)
+	GetTotalsPerDay(context.Context) ([]models.DailyEntry, error)
 }
 
-func (f *Fetcher) getTotals(args simplejson.QueryArgs) ([]models.CountryEntry, error) {
+func (f *Fetcher) getTotals(ctx context.Context, args simplejson.QueryArgs) ([]models.DailyEntry, error) {
 	if len(args.Args.AdHocFilters) == 0 {
-		return f.DB.GetTotalsPerDay()
+		return f.DB.GetTotalsPerDay(ctx)
 	}
 
 	countryName, err := evaluateAdHocFilter(args.AdHocFilters)
@@ -27,10 +28,10 @@ func (f *Fetcher) getTotals(args simplejson.QueryArgs) ([]models.CountryEntry, e
 		return nil, err
 	}
 
-	return f.DB.GetAllForCountryName(countryName)
+	return f.DB.GetDailyForCountryName(ctx, countryName)
 }
 
-func dbEntriesToTable(entries []models.CountryEntry) (table *data.Table) {
+func dbEntriesToTable(entries []models.DailyEntry) (table *data.Table) {
 	timestamps := make([]time.Time, len(entries))
 	confirmed := make([]float64, len(entries))
 	deaths := make([]float64, len(entries))
@@ -47,22 +48,19 @@ func dbEntriesToTable(entries []models.CountryEntry) (table *data.Table) {
 	)
 }
 
-func createDeltas(totals *data.Table) (deltas *data.Table) {
-	confirmed, _ := totals.GetFloatValues("confirmed")
-	deaths, _ := totals.GetFloatValues("deaths")
-	return data.New(
-		data.Column{Name: "timestamp", Values: totals.GetTimestamps()},
-		data.Column{Name: "confirmed", Values: makeDeltas(confirmed)},
-		data.Column{Name: "deaths", Values: makeDeltas(deaths)},
-	)
-}
+func dbEntriesToDeltasTable(entries []models.DailyEntry) (table *data.Table) {
+	timestamps := make([]time.Time, len(entries))
+	confirmed := make([]float64, len(entries))
+	deaths := make([]float64, len(entries))
 
-func makeDeltas(input []float64) (output []float64) {
-	var current float64
-	output = make([]float64, len(input))
-	for idx, value := range input {
-		output[idx] = value - current
-		current = value
+	for idx, entry := range entries {
+		timestamps[idx] = entry.Timestamp
+		confirmed[idx] = float64(entry.NewConfirmed)
+		deaths[idx] = float64(entry.NewDeaths)
 	}
-	return
+	return data.New(
+		data.Column{Name: "timestamp", Values: timestamps},
+		data.Column{Name: "confirmed", Values: confirmed},
+		data.Column{Name: "deaths", Values: deaths},
+	)
 }
@@ -0,0 +1,30 @@
+package simplejsonserver
+
+import (
+	"context"
+	"github.com/clambin/covid19/tracing"
+	"github.com/clambin/simplejson/v6"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/clambin/covid19/simplejsonserver")
+
+// tracedHandler creates a span for each query of a target
+type tracedHandler struct {
+	simplejson.Handler
+	target string
+}
+
+func (h tracedHandler) Endpoints() simplejson.Endpoints {
+	endpoints := h.Handler.Endpoints()
+	if query := endpoints.Query; query != nil {
+		endpoints.Query = func(ctx context.Context, req simplejson.QueryRequest) (simplejson.Response, error) {
+			ctx, span := tracer.Start(ctx, "query "+h.target, trace.WithAttributes(attribute.String("simplejson.target", h.target)))
+			response, err := query(ctx, req)
+			return response, tracing.End(span, err)
+		}
+	}
+	return endpoints
+}
@@ -14,7 +14,7 @@ type Handler struct {
 }
 
 type CovidGetter interface {
-	CountEntriesByTime(time.Time, time.Time) ([]db.TimestampCount, error)
+	CountEntriesByTime(context.Context, time.Time, time.Time) ([]db.TimestampCount, error)
 }
 
 var _ simplejson.Handler = &Handler{}
@@ -25,8 +25,8 @@ func (handler *Handler) Endpoints() (endpoints simplejson.Endpoints) {
 	}
 }
 
-func (handler *Handler) tableQuery(_ context.Context, req simplejson.QueryRequest) (simplejson.Response, error) {
-	entries, err := handler.DB.CountEntriesByTime(req.Args.Range.From, req.Args.Range.To)
+func (handler *Handler) tableQuery(ctx context.Context, req simplejson.QueryRequest) (simplejson.Response, error) {
+	entries, err := handler.DB.CountEntriesByTime(ctx, req.Args.Range.From, req.Args.Range.To)
 	if err != nil {
 		return nil, err
 	}
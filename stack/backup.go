@@ -0,0 +1,55 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/exp/slog"
+	"os"
+)
+
+// Backup writes the covid19 and population tables to a new archive file
+func (stack *Stack) Backup(ctx context.Context, filename string) (err error) {
+	// don't overwrite an earlier backup
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("backup: %w", closeErr)
+		}
+		if err != nil {
+			// don't leave an incomplete archive behind
+			_ = os.Remove(filename)
+		}
+	}()
+
+	manifest, err := stack.DB.Backup(ctx, f)
+	if err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	slog.Info("database backed up", "file", filename, "schemaVersion", manifest.SchemaVersion,
+		"covid19", manifest.Rows["covid19"], "population", manifest.Rows["population"])
+	return nil
+}
+
+// Restore loads an archive written by Backup into an empty database
+func (stack *Stack) Restore(ctx context.Context, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+
+	manifest, err := stack.DB.Restore(ctx, f, info.Size())
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	slog.Info("database restored", "file", filename, "created", manifest.Created, "schemaVersion", manifest.SchemaVersion,
+		"covid19", manifest.Rows["covid19"], "population", manifest.Rows["population"])
+	return nil
+}
@@ -0,0 +1,34 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/exp/slog"
+	"time"
+)
+
+// Compact downsamples the covid19 figures older than retention.downsampleAfter days, keeping only the last entry per
+// country per day
+func (stack *Stack) Compact(ctx context.Context) error {
+	days := stack.Cfg.Retention.DownsampleAfter
+	if days == 0 {
+		return errors.New("downsampling is disabled: set retention.downsampleAfter")
+	}
+	// compacting relies on the daily views of the latest schema to select the entries to keep
+	status, err := stack.DB.MigrationStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("migration status: %w", err)
+	}
+	if status.Pending() > 0 {
+		return fmt.Errorf("database schema is at version %d, latest is %d: run 'db migrate up' first", status.Version, status.Latest)
+	}
+
+	before := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -days)
+	deleted, err := stack.CovidStore.Compact(ctx, before)
+	if err != nil {
+		return fmt.Errorf("compact: %w", err)
+	}
+	slog.Info("database compacted", "before", before.Format("2006-01-02"), "deleted", deleted)
+	return nil
+}
@@ -0,0 +1,83 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/clambin/covid19/covid/shoutrrr"
+	"github.com/clambin/covid19/models"
+	"golang.org/x/exp/slog"
+	"time"
+)
+
+// FailureNotifier reports failed loader runs, and checks that new data is still being received
+type FailureNotifier struct {
+	// Sender sends the failure notifications. If nil, failures are only logged
+	Sender shoutrrr.Sender
+	// StaleAfter is the number of days without new data after which the data is considered stale. Zero disables the check
+	StaleAfter int
+	Store      LatestGetter
+}
+
+// LatestGetter returns the latest entry for each country
+type LatestGetter interface {
+	GetLatestForCountries(context.Context, time.Time) (map[string]models.CountryEntry, error)
+}
+
+// StaleDataError is returned by CheckStale when no country has received new data in the configured number of days
+type StaleDataError struct {
+	// Last is the most recent timestamp in the database
+	Last time.Time
+	Days int
+}
+
+func (e *StaleDataError) Error() string {
+	if e.Last.IsZero() {
+		return "no data found"
+	}
+	return fmt.Sprintf("no new data for %d days (last update: %s)", e.Days, e.Last.Format(time.RFC3339))
+}
+
+// CheckStale returns a StaleDataError if the most recent entry in the database is older than StaleAfter days
+func (f FailureNotifier) CheckStale(ctx context.Context, now time.Time) error {
+	if f.StaleAfter <= 0 {
+		return nil
+	}
+
+	entries, err := f.Store.GetLatestForCountries(ctx, time.Time{})
+	if err != nil {
+		return fmt.Errorf("get latest: %w", err)
+	}
+
+	var last time.Time
+	for _, entry := range entries {
+		if entry.Timestamp.After(last) {
+			last = entry.Timestamp
+		}
+	}
+
+	if days := int(now.Sub(last).Hours() / 24); last.IsZero() || days >= f.StaleAfter {
+		return &StaleDataError{Last: last, Days: days}
+	}
+	return nil
+}
+
+// Notify reports the failure of a command. If err is nil, nothing is reported
+func (f FailureNotifier) Notify(command string, err error) {
+	if err == nil {
+		return
+	}
+	slog.Error(command+" failed", "err", err)
+	if f.Sender == nil {
+		return
+	}
+
+	title := "covid19 " + command + " failed"
+	var staleErr *StaleDataError
+	if errors.As(err, &staleErr) {
+		title = "covid19 " + command + ": stale data"
+	}
+	if err = f.Sender.Send(title, err.Error()); err != nil {
+		slog.Error("failed to send failure notification", "err", err)
+	}
+}
@@ -0,0 +1,71 @@
+package stack_test
+
+import (
+	"context"
+	"errors"
+	"github.com/clambin/covid19/covid/shoutrrr/mocks"
+	"github.com/clambin/covid19/internal/testtools/db/covid"
+	"github.com/clambin/covid19/models"
+	"github.com/clambin/covid19/stack"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFailureNotifier_CheckStale(t *testing.T) {
+	now := time.Date(2023, time.March, 22, 12, 0, 0, 0, time.UTC)
+	store := covid.FakeStore{Records: []models.CountryEntry{
+		{Timestamp: now.AddDate(0, 0, -5), Name: "Belgium", Code: "BE"},
+		{Timestamp: now.AddDate(0, 0, -2), Name: "US", Code: "US"},
+	}}
+
+	tests := []struct {
+		name       string
+		staleAfter int
+		records    []models.CountryEntry
+		stale      bool
+	}{
+		{name: "disabled", staleAfter: 0, records: store.Records},
+		{name: "fresh", staleAfter: 3, records: store.Records},
+		{name: "stale", staleAfter: 2, records: store.Records, stale: true},
+		{name: "empty", staleAfter: 2, stale: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := stack.FailureNotifier{StaleAfter: tt.staleAfter, Store: &covid.FakeStore{Records: tt.records}}
+			err := f.CheckStale(context.Background(), now)
+			if !tt.stale {
+				assert.NoError(t, err)
+				return
+			}
+			var staleErr *stack.StaleDataError
+			assert.ErrorAs(t, err, &staleErr)
+		})
+	}
+
+	f := stack.FailureNotifier{StaleAfter: 1, Store: &covid.FakeStore{Fail: true}}
+	err := f.CheckStale(context.Background(), now)
+	assert.Error(t, err)
+	var staleErr *stack.StaleDataError
+	assert.False(t, errors.As(err, &staleErr))
+}
+
+func TestFailureNotifier_Notify(t *testing.T) {
+	s := mocks.NewSender(t)
+	f := stack.FailureNotifier{Sender: s}
+
+	// no error: no notification
+	f.Notify("loader", nil)
+
+	s.On("Send", "covid19 loader failed", "update: db error").Return(nil).Once()
+	f.Notify("loader", errors.New("update: db error"))
+
+	last := time.Date(2023, time.March, 20, 12, 0, 0, 0, time.UTC)
+	s.On("Send", "covid19 loader: stale data", "no new data for 2 days (last update: 2023-03-20T12:00:00Z)").Return(nil).Once()
+	f.Notify("loader", &stack.StaleDataError{Last: last, Days: 2})
+
+	// no sender: only logged
+	f = stack.FailureNotifier{}
+	f.Notify("population", errors.New("failed"))
+}
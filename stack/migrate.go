@@ -0,0 +1,46 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/exp/slog"
+	"io"
+)
+
+// MigrateUp applies all pending database migrations
+func (stack *Stack) MigrateUp(ctx context.Context) error {
+	return stack.migrate(ctx, stack.DB.MigrateUp(ctx))
+}
+
+// MigrateDown rolls back the provided number of database migrations. If steps is zero, all migrations are rolled back,
+// deleting all tables
+func (stack *Stack) MigrateDown(ctx context.Context, steps uint) error {
+	return stack.migrate(ctx, stack.DB.MigrateDown(ctx, steps))
+}
+
+// MigrateTo applies or rolls back database migrations until the schema is at the provided version
+func (stack *Stack) MigrateTo(ctx context.Context, version uint) error {
+	return stack.migrate(ctx, stack.DB.MigrateTo(ctx, version))
+}
+
+func (stack *Stack) migrate(ctx context.Context, err error) error {
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	status, err := stack.DB.MigrationStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("migration status: %w", err)
+	}
+	slog.Info("database migrated", "version", status.Version, "latest", status.Latest)
+	return nil
+}
+
+// MigrationStatus writes the version of the database schema to w
+func (stack *Stack) MigrationStatus(ctx context.Context, w io.Writer) error {
+	status, err := stack.DB.MigrationStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("migration status: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "version: %d\nlatest:  %d\npending: %d\ndirty:   %t\n", status.Version, status.Latest, status.Pending(), status.Dirty)
+	return err
+}
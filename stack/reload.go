@@ -0,0 +1,170 @@
+package stack
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"github.com/clambin/covid19/configuration"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/exp/slog"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader reloads the configuration of the handler when the configuration file changes, or when it is triggered (e.g. by
+// SIGHUP). Invalid configurations are rejected. The handler only uses the debug setting at runtime, so that is the only
+// setting that is applied: changes to the postgres and tracing sections, port and prometheusPort require a restart, and
+// the other sections are only used by the loader and population commands. Changes that aren't applied are logged.
+type Reloader struct {
+	// Filename of the configuration file
+	Filename string
+	// Load loads the configuration from the content of the configuration file
+	Load func(io.Reader) (*configuration.Configuration, error)
+	// LogLevel is set to debug when the configuration enables debug logging, and to info otherwise
+	LogLevel *slog.LevelVar
+	// Interval between two checks of the configuration file
+	Interval time.Duration
+	lock     sync.RWMutex
+	// started is the configuration the handler was started with
+	started  *configuration.Configuration
+	checksum [sha256.Size]byte
+	reloads  *prometheus.CounterVec
+	reloaded prometheus.Gauge
+}
+
+var _ prometheus.Collector = &Reloader{}
+
+// DefaultReloadInterval is the default interval between two checks of the configuration file
+const DefaultReloadInterval = 10 * time.Second
+
+// NewReloader creates a Reloader for the configuration the handler was started with
+func NewReloader(filename string, cfg *configuration.Configuration, load func(io.Reader) (*configuration.Configuration, error), level *slog.LevelVar) *Reloader {
+	r := Reloader{
+		Filename: filename,
+		Load:     load,
+		LogLevel: level,
+		Interval: DefaultReloadInterval,
+		started:  cfg,
+		reloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "covid",
+			Subsystem: "config",
+			Name:      "reloads_total",
+			Help:      "Number of configuration reloads, by result",
+		}, []string{"result"}),
+		reloaded: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "covid",
+			Subsystem: "config",
+			Name:      "last_reload_success_timestamp_seconds",
+			Help:      "Timestamp of the last successful configuration reload",
+		}),
+	}
+	if content, err := os.ReadFile(filename); err == nil {
+		r.checksum = sha256.Sum256(content)
+	}
+	return &r
+}
+
+// LogLevel returns the log level for the debug setting of the configuration
+func LogLevel(debug bool) slog.Level {
+	if debug {
+		return slog.LevelDebug
+	}
+	return slog.LevelInfo
+}
+
+// Run checks the configuration file for changes at every Interval and reloads the configuration when it changes, or
+// when trigger receives a signal. Run returns when the context is canceled.
+func (r *Reloader) Run(ctx context.Context, trigger <-chan os.Signal) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			content, err := os.ReadFile(r.Filename)
+			if err != nil {
+				slog.Warn("failed to check configuration file", "err", err)
+			} else if r.changed(content) {
+				slog.Info("configuration file changed. reloading")
+				_ = r.reload(content)
+			}
+		case <-trigger:
+			slog.Info("reloading configuration")
+			_ = r.Reload()
+		}
+	}
+}
+
+// Reload loads the configuration file. If the new configuration is valid, its debug setting is applied
+func (r *Reloader) Reload() error {
+	content, err := os.ReadFile(r.Filename)
+	if err != nil {
+		r.reloads.WithLabelValues("failure").Inc()
+		slog.Error("failed to read configuration file. keeping current configuration", "err", err)
+		return fmt.Errorf("configuration: %w", err)
+	}
+	return r.reload(content)
+}
+
+func (r *Reloader) changed(content []byte) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return sha256.Sum256(content) != r.checksum
+}
+
+func (r *Reloader) reload(content []byte) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// don't retry an invalid configuration file until it changes again
+	r.checksum = sha256.Sum256(content)
+
+	cfg, err := r.Load(bytes.NewReader(content))
+	if err != nil {
+		r.reloads.WithLabelValues("failure").Inc()
+		slog.Error("invalid configuration. keeping current configuration", "err", err)
+		return fmt.Errorf("load configuration: %w", err)
+	}
+
+	var restart, unused []string
+	for _, field := range r.started.Changes(*cfg) {
+		switch field {
+		case "debug":
+		case "postgres", "tracing", "port", "prometheusPort":
+			restart = append(restart, field)
+		default:
+			unused = append(unused, field)
+		}
+	}
+	if len(restart) > 0 {
+		slog.Warn("changes require a restart. ignoring them", "fields", restart)
+	}
+	if len(unused) > 0 {
+		slog.Info("changes aren't used by the handler. ignoring them", "fields", unused)
+	}
+	if r.LogLevel != nil {
+		r.LogLevel.Set(LogLevel(cfg.Debug))
+	}
+
+	r.reloads.WithLabelValues("success").Inc()
+	r.reloaded.SetToCurrentTime()
+	slog.Info("configuration reloaded")
+	return nil
+}
+
+// Describe implements the prometheus.Collector interface
+func (r *Reloader) Describe(descs chan<- *prometheus.Desc) {
+	r.reloads.Describe(descs)
+	r.reloaded.Describe(descs)
+}
+
+// Collect implements the prometheus.Collector interface
+func (r *Reloader) Collect(metrics chan<- prometheus.Metric) {
+	r.reloads.Collect(metrics)
+	r.reloaded.Collect(metrics)
+}
@@ -0,0 +1,92 @@
+package stack_test
+
+import (
+	"context"
+	"github.com/clambin/covid19/configuration"
+	"github.com/clambin/covid19/stack"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const reloadConfig = `
+postgres:
+  password: some-password
+monitor:
+  rapidAPIKey: some-key
+`
+
+func TestReloader_Reload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(reloadConfig), 0600))
+
+	cfg, err := configuration.LoadConfiguration(strings.NewReader(reloadConfig))
+	require.NoError(t, err)
+	var level slog.LevelVar
+	r := stack.NewReloader(filename, cfg, load, &level)
+
+	// valid configuration. changes that require a restart don't fail the reload
+	require.NoError(t, os.WriteFile(filename, []byte(reloadConfig+"debug: true\nport: 8081\ntracing:\n  exporter: stdout\n"), 0600))
+	require.NoError(t, r.Reload())
+	assert.Equal(t, slog.LevelDebug, level.Level())
+
+	// invalid configuration
+	require.NoError(t, os.WriteFile(filename, []byte(reloadConfig+"debug: false\nhots: localhost\n"), 0600))
+	assert.Error(t, r.Reload())
+	assert.Equal(t, slog.LevelDebug, level.Level())
+
+	assert.NoError(t, testutil.CollectAndCompare(r, strings.NewReader(`
+# HELP covid_config_reloads_total Number of configuration reloads, by result
+# TYPE covid_config_reloads_total counter
+covid_config_reloads_total{result="failure"} 1
+covid_config_reloads_total{result="success"} 1
+`), "covid_config_reloads_total"))
+}
+
+func TestReloader_Run(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(reloadConfig), 0600))
+
+	cfg, err := configuration.LoadConfiguration(strings.NewReader(reloadConfig))
+	require.NoError(t, err)
+
+	t.Run("file changes", func(t *testing.T) {
+		var level slog.LevelVar
+		r := stack.NewReloader(filename, cfg, load, &level)
+		r.Interval = 10 * time.Millisecond
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go r.Run(ctx, nil)
+
+		require.NoError(t, os.WriteFile(filename, []byte(reloadConfig+"debug: true\n"), 0600))
+		assert.Eventually(t, func() bool { return level.Level() == slog.LevelDebug }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("trigger", func(t *testing.T) {
+		level := new(slog.LevelVar)
+		level.Set(slog.LevelDebug)
+		r := stack.NewReloader(filename, cfg, load, level)
+		r.Interval = time.Hour
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		trigger := make(chan os.Signal)
+		go r.Run(ctx, trigger)
+
+		require.NoError(t, os.WriteFile(filename, []byte(reloadConfig+"debug: false\n"), 0600))
+		trigger <- os.Interrupt
+		assert.Eventually(t, func() bool { return level.Level() == slog.LevelInfo }, time.Second, 10*time.Millisecond)
+	})
+}
+
+func load(content io.Reader) (*configuration.Configuration, error) {
+	return configuration.LoadConfiguration(content)
+}
@@ -0,0 +1,145 @@
+package stack
+
+import (
+	"errors"
+	"fmt"
+	"github.com/clambin/covid19/configuration"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"golang.org/x/exp/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RunMetrics records the duration and the result of a run of the loader or population command. When the run is done,
+// these metrics, and those of the components used during the run, are pushed to a Prometheus Pushgateway and/or
+// written to a node-exporter textfile, as configured.
+type RunMetrics struct {
+	Command    string
+	Cfg        configuration.LoaderMetrics
+	start      time.Time
+	collectors []prometheus.Collector
+	duration   prometheus.Gauge
+	timestamp  prometheus.Gauge
+	success    prometheus.Gauge
+}
+
+var _ prometheus.Collector = &RunMetrics{}
+
+// PushGatewayJob is the job name of the metrics pushed to the Pushgateway. The command is added as a grouping label
+const PushGatewayJob = "covid19"
+
+// NewRunMetrics starts recording a run of the provided command
+func NewRunMetrics(command string, cfg configuration.LoaderMetrics) *RunMetrics {
+	r := RunMetrics{
+		Command: command,
+		Cfg:     cfg,
+		start:   time.Now(),
+		duration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "covid",
+			Subsystem: "run",
+			Name:      "duration_seconds",
+			Help:      "Duration of the last run",
+		}),
+		timestamp: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "covid",
+			Subsystem: "run",
+			Name:      "last_timestamp_seconds",
+			Help:      "Timestamp of the end of the last run",
+		}),
+		success: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "covid",
+			Subsystem: "run",
+			Name:      "success",
+			Help:      "1 if the last run succeeded, 0 if it failed",
+		}),
+	}
+	r.collectors = []prometheus.Collector{&r}
+	return &r
+}
+
+// Register adds the metrics of a component used during the run
+func (r *RunMetrics) Register(c prometheus.Collector) {
+	r.collectors = append(r.collectors, c)
+}
+
+// Done records the result of the run and exports the metrics. Export failures are logged: they don't fail the run
+func (r *RunMetrics) Done(runErr error) {
+	r.duration.Set(time.Since(r.start).Seconds())
+	r.timestamp.SetToCurrentTime()
+	r.success.Set(0)
+	if runErr == nil {
+		r.success.Set(1)
+	}
+
+	if err := r.export(); err != nil {
+		slog.Error("failed to export metrics", "err", err, "command", r.Command)
+	}
+}
+
+func (r *RunMetrics) export() error {
+	var errs []string
+	if r.Cfg.PushGateway != "" {
+		if err := r.push(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if r.Cfg.TextFileDirectory != "" {
+		if err := r.writeTextFile(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (r *RunMetrics) push() error {
+	pusher := push.New(r.Cfg.PushGateway, PushGatewayJob).
+		Grouping("command", r.Command).
+		Client(&http.Client{Timeout: 10 * time.Second})
+	for _, c := range r.collectors {
+		pusher.Collector(c)
+	}
+	if err := pusher.Push(); err != nil {
+		return fmt.Errorf("pushgateway: %w", err)
+	}
+	return nil
+}
+
+// TextFile returns the name of the file written in the textfile collector directory
+func (r *RunMetrics) TextFile() string {
+	return filepath.Join(r.Cfg.TextFileDirectory, "covid19_"+r.Command+".prom")
+}
+
+func (r *RunMetrics) writeTextFile() error {
+	// node-exporter merges all files in the directory, so label the metrics with the command that wrote them
+	registry := prometheus.NewRegistry()
+	registerer := prometheus.WrapRegistererWith(prometheus.Labels{"command": r.Command}, registry)
+	for _, c := range r.collectors {
+		if err := registerer.Register(c); err != nil {
+			return fmt.Errorf("textfile: %w", err)
+		}
+	}
+	if err := prometheus.WriteToTextfile(r.TextFile(), registry); err != nil {
+		return fmt.Errorf("textfile: %w", err)
+	}
+	return nil
+}
+
+// Describe implements the prometheus.Collector interface
+func (r *RunMetrics) Describe(descs chan<- *prometheus.Desc) {
+	r.duration.Describe(descs)
+	r.timestamp.Describe(descs)
+	r.success.Describe(descs)
+}
+
+// Collect implements the prometheus.Collector interface
+func (r *RunMetrics) Collect(metrics chan<- prometheus.Metric) {
+	r.duration.Collect(metrics)
+	r.timestamp.Collect(metrics)
+	r.success.Collect(metrics)
+}
@@ -0,0 +1,47 @@
+package stack_test
+
+import (
+	"errors"
+	"github.com/clambin/covid19/configuration"
+	"github.com/clambin/covid19/stack"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestRunMetrics_TextFile(t *testing.T) {
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "foo_total", Help: "foo"})
+	counter.Inc()
+
+	run := stack.NewRunMetrics("loader", configuration.LoaderMetrics{TextFileDirectory: t.TempDir()})
+	run.Register(counter)
+	run.Done(nil)
+
+	body, err := os.ReadFile(run.TextFile())
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `foo_total{command="loader"} 1`)
+	assert.Contains(t, string(body), `covid_run_success{command="loader"} 1`)
+	assert.Contains(t, string(body), `covid_run_duration_seconds{command="loader"}`)
+}
+
+func TestRunMetrics_PushGateway(t *testing.T) {
+	var path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path = req.URL.Path
+		b, _ := io.ReadAll(req.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	run := stack.NewRunMetrics("population", configuration.LoaderMetrics{PushGateway: server.URL})
+	run.Done(errors.New("fail"))
+
+	assert.Equal(t, "/metrics/job/"+stack.PushGatewayJob+"/command/population", path)
+	assert.Contains(t, body, "covid_run_success")
+}
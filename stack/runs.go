@@ -0,0 +1,97 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"github.com/clambin/covid19/db"
+	"golang.org/x/exp/slog"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// endRunTimeout is the time allowed to record the end of a run, also when the run was interrupted
+const endRunTimeout = 10 * time.Second
+
+// startRun records the start of a run in the audit log. It returns the covid store that adds the run's covid19 rows,
+// stamped with the run's id, and the function that records the end of the run, with the counts of a loader run (nil
+// for other runs). Failures to update the audit log are logged, but don't fail the run.
+func (stack *Stack) startRun(ctx context.Context, source string) (*db.PGCovidStore, func(*db.RunCounts, error)) {
+	id, err := stack.RunStore.StartRun(ctx, source, stack.Cfg.Hash())
+	if err != nil {
+		slog.Warn("failed to record start of run", "source", source, "err", err)
+		return stack.CovidStore, func(*db.RunCounts, error) {}
+	}
+	slog.Debug("run started", "source", source, "id", id)
+
+	return stack.CovidStore.ForRun(id), func(counts *db.RunCounts, runErr error) {
+		ctx, cancel := context.WithTimeout(context.Background(), endRunTimeout)
+		defer cancel()
+		if err := stack.RunStore.EndRun(ctx, id, counts, runErr); err != nil {
+			slog.Warn("failed to record end of run", "source", source, "id", id, "err", err)
+		}
+	}
+}
+
+// ListRuns writes the most recent runs in the audit log to w. If limit is zero, all runs are listed
+func (stack *Stack) ListRuns(ctx context.Context, w io.Writer, limit int) error {
+	runs, err := stack.RunStore.ListRuns(ctx, limit)
+	if err != nil {
+		return fmt.Errorf("list runs: %w", err)
+	}
+	return WriteRuns(w, runs)
+}
+
+// Rollback deletes all covid19 rows added by a run
+func (stack *Stack) Rollback(ctx context.Context, id int64) error {
+	deleted, err := stack.RunStore.Rollback(ctx, id)
+	if err != nil {
+		return fmt.Errorf("rollback: %w", err)
+	}
+	slog.Info("run rolled back", "id", id, "deleted", deleted)
+	return nil
+}
+
+// WriteRuns writes the runs as a table
+func WriteRuns(w io.Writer, runs []db.IngestionRun) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tSOURCE\tSTART\tDURATION\tFETCHED\tREJECTED\tUNKNOWN\tINSERTED\tCONFIG\tSTATUS")
+	for _, run := range runs {
+		duration := "-"
+		if run.End != nil {
+			duration = run.End.Sub(run.Start).Round(time.Millisecond).String()
+		}
+		configHash := run.ConfigHash
+		if len(configHash) > 12 {
+			configHash = configHash[:12]
+		}
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			run.ID, run.Source, run.Start.UTC().Format(time.RFC3339), duration,
+			runCount(run.Fetched), runCount(run.Rejected), runCount(run.UnknownCountries), run.Inserted,
+			configHash, runStatus(run),
+		)
+	}
+	return tw.Flush()
+}
+
+// runCount formats a count of a run. Counts that weren't recorded are shown as "-"
+func runCount(count *int) string {
+	if count == nil {
+		return "-"
+	}
+	return strconv.Itoa(*count)
+}
+
+func runStatus(run db.IngestionRun) string {
+	switch {
+	case run.RolledBack != nil:
+		return "rolled back at " + run.RolledBack.UTC().Format(time.RFC3339)
+	case run.End == nil:
+		return "incomplete"
+	case run.Error != "":
+		return "failed: " + run.Error
+	default:
+		return "ok"
+	}
+}
@@ -0,0 +1,33 @@
+package stack_test
+
+import (
+	"bytes"
+	"github.com/clambin/covid19/db"
+	"github.com/clambin/covid19/stack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestWriteRuns(t *testing.T) {
+	start := time.Date(2023, time.May, 1, 6, 0, 0, 0, time.UTC)
+	end := start.Add(1500 * time.Millisecond)
+	rolledBack := start.Add(time.Hour)
+	fetched, rejected, unknown := 200, 5, 1
+	runs := []db.IngestionRun{
+		{ID: 4, Source: "covid", Start: start, ConfigHash: "0123456789abcdef"},
+		{ID: 3, Source: "covid", Start: start, End: &end, Fetched: &fetched, Rejected: &rejected, UnknownCountries: &unknown, Inserted: 2, Error: "fail"},
+		{ID: 2, Source: "population", Start: start, End: &end},
+		{ID: 1, Source: "covid", Start: start, End: &end, Inserted: 10, RolledBack: &rolledBack},
+	}
+
+	var output bytes.Buffer
+	require.NoError(t, stack.WriteRuns(&output, runs))
+	assert.Equal(t, `ID  SOURCE      START                 DURATION  FETCHED  REJECTED  UNKNOWN  INSERTED  CONFIG        STATUS
+4   covid       2023-05-01T06:00:00Z  -         -        -         -        0         0123456789ab  incomplete
+3   covid       2023-05-01T06:00:00Z  1.5s      200      5         1        2                       failed: fail
+2   population  2023-05-01T06:00:00Z  1.5s      -        -         -        0                       ok
+1   covid       2023-05-01T06:00:00Z  1.5s      -        -         -        10                      rolled back at 2023-05-01T07:00:00Z
+`, output.String())
+}
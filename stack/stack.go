@@ -2,27 +2,46 @@ package stack
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/clambin/covid19/backfill"
 	"github.com/clambin/covid19/configuration"
 	covidProbe "github.com/clambin/covid19/covid"
 	"github.com/clambin/covid19/db"
+	"github.com/clambin/covid19/health"
 	populationProbe "github.com/clambin/covid19/population"
 	"github.com/clambin/covid19/simplejsonserver"
+	"github.com/clambin/covid19/tracing"
 	"github.com/clambin/simplejson/v6"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
 	"golang.org/x/exp/slog"
 	"net/http"
 	"time"
 )
 
+var tracer = otel.Tracer("github.com/clambin/covid19/stack")
+
 // Stack groups the different components that make up the application
 type Stack struct {
-	Cfg              *configuration.Configuration
-	DB               *db.DB
-	CovidStore       *db.PGCovidStore
-	PopulationStore  *db.PGPopulationStore
-	SimpleJSONServer *simplejson.Server
+	Cfg               *configuration.Configuration
+	DB                *db.DB
+	CovidStore        *db.PGCovidStore
+	PopulationStore   *db.PGPopulationStore
+	NotificationStore *db.PGNotificationStore
+	LoadStore         *db.PGLoadStore
+	RunStore          *db.PGRunStore
+	PopulationUpdater PopulationUpdater
+	SimpleJSONServer  *simplejson.Server
+	FailureNotifier   FailureNotifier
+	// ReadDB serves the queries of the SimpleJSON server. It is the read replica, if one is configured, or DB
+	ReadDB *db.DB
+}
+
+// PopulationUpdater loads the latest population figures in the database
+type PopulationUpdater interface {
+	Update(context.Context) (int, error)
 }
 
 var _ prometheus.Collector = &Stack{}
@@ -37,75 +56,213 @@ func CreateStack(cfg *configuration.Configuration) (*Stack, error) {
 	covidStore := db.NewCovidStore(dbh)
 	populationStore := db.NewPopulationStore(dbh)
 
+	readDB := dbh
+	if cfg.Postgres.Replica != "" {
+		if readDB, err = db.NewReplica(cfg.Postgres, dbh); err != nil {
+			return nil, fmt.Errorf("database: %w", err)
+		}
+	}
+
+	failureNotifier, err := newFailureNotifier(cfg.Monitor, covidStore)
+	if err != nil {
+		return nil, fmt.Errorf("failure notifications: %w", err)
+	}
+
 	return &Stack{
-		Cfg:              cfg,
-		DB:               dbh,
-		CovidStore:       covidStore,
-		PopulationStore:  populationStore,
-		SimpleJSONServer: simplejsonserver.New(covidStore, populationStore),
+		Cfg:               cfg,
+		DB:                dbh,
+		ReadDB:            readDB,
+		CovidStore:        covidStore,
+		PopulationStore:   populationStore,
+		NotificationStore: db.NewNotificationStore(dbh),
+		LoadStore:         db.NewLoadStore(dbh),
+		RunStore:          db.NewRunStore(dbh),
+		PopulationUpdater: newPopulationUpdater(cfg.Monitor, populationStore),
+		SimpleJSONServer:  simplejsonserver.New(db.NewCovidStore(readDB), db.NewPopulationStore(readDB)),
+		FailureNotifier:   failureNotifier,
 	}, nil
 }
 
-// RunHandler runs the SimpleJSON server
-func (stack *Stack) RunHandler() error {
-	return http.ListenAndServe(fmt.Sprintf(":%d", stack.Cfg.Port), stack.SimpleJSONServer)
+func newFailureNotifier(cfg configuration.MonitorConfiguration, store LatestGetter) (FailureNotifier, error) {
+	f := FailureNotifier{StaleAfter: cfg.Failures.StaleAfter, Store: store}
+	if cfg.Failures.Route == "" {
+		return f, nil
+	}
+	route, found := cfg.Notifications.GetRoute(cfg.Failures.Route)
+	if !found {
+		return f, fmt.Errorf("unknown route %q", cfg.Failures.Route)
+	}
+	sender, err := covidProbe.NewSender(route)
+	if err == nil {
+		f.Sender = sender
+	}
+	return f, err
+}
+
+// newPopulationUpdater imports population figures from a file, if one is configured. Otherwise, it uses RapidAPI
+func newPopulationUpdater(cfg configuration.MonitorConfiguration, store populationProbe.Adder) PopulationUpdater {
+	if cfg.Population.File != "" {
+		return populationProbe.NewCSVImporter(cfg.Population.File, store)
+	}
+	p := populationProbe.New(cfg.RapidAPIKey, store)
+	p.MaxConcurrentJobs = cfg.Population.MaxConcurrentJobs
+	return p
+}
+
+// ShutdownTimeout is the time the handler waits for open requests to complete when it shuts down
+const ShutdownTimeout = 30 * time.Second
+
+// RunHandler runs the SimpleJSON server and the Prometheus metrics server until the context is canceled, or one of the
+// servers fails. Open requests are then given ShutdownTimeout to complete. The SimpleJSON server also serves the
+// /healthz, /readyz and /status endpoints.
+func (stack *Stack) RunHandler(ctx context.Context) error {
+	handler := http.NewServeMux()
+	h := health.Handler{DB: stack.DB, Covid: stack.CovidStore, Population: stack.PopulationStore, Loads: stack.LoadStore}
+	h.Register(handler)
+	handler.Handle("/", stack.SimpleJSONServer)
+
+	metrics := http.NewServeMux()
+	metrics.Handle("/metrics", promhttp.Handler())
+
+	servers := []*http.Server{
+		{Addr: fmt.Sprintf(":%d", stack.Cfg.Port), Handler: handler},
+		{Addr: fmt.Sprintf(":%d", stack.Cfg.PrometheusPort), Handler: metrics},
+	}
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("listen %s: %w", server.Addr, err)
+			}
+		}(server)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		slog.Info("shutting down")
+	case err = <-errs:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil && err == nil {
+			err = fmt.Errorf("shutdown %s: %w", server.Addr, shutdownErr)
+		}
+	}
+	return err
+}
+
+// Load retrieves the latest covid19 figures and stores them in the database. If it fails, or if no new data has been
+// received for the configured number of days, a failure notification is sent. The run is recorded in the audit log.
+func (stack *Stack) Load(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "load")
+	defer func() { _ = tracing.End(span, err) }()
+	run := NewRunMetrics("loader", stack.Cfg.LoaderMetrics)
+	defer func() { run.Done(err) }()
+	store, endRun := stack.startRun(ctx, health.CovidSource)
+	var counts *db.RunCounts
+	defer func() { endRun(counts, err) }()
+
+	counts, err = stack.load(ctx, store, run)
+	if err == nil {
+		stack.setLastLoad(ctx, health.CovidSource)
+		err = stack.FailureNotifier.CheckStale(ctx, time.Now())
+	}
+	stack.FailureNotifier.Notify("loader", err)
+	return err
 }
 
-// Load retrieves the latest covid19 figures and stores them in the database
-func (stack *Stack) Load() {
-	if stack.loadIfEmpty() {
-		return
+// load adds the new covid19 figures through store. It returns the counts of the update, or nil if the database was backfilled
+func (stack *Stack) load(ctx context.Context, store *db.PGCovidStore, run *RunMetrics) (*db.RunCounts, error) {
+	if loaded, err := stack.loadIfEmpty(ctx, store); loaded || err != nil {
+		return nil, err
 	}
 
 	start := time.Now()
-	cp := covidProbe.New(&stack.Cfg.Monitor, stack.CovidStore)
-	if count, err := cp.Update(context.Background()); err == nil {
-		slog.Info("discovered country figures", "count", count, "duration", time.Since(start))
-	} else {
-		slog.Error("failed to update COVID-19 figures", "err", err)
+	cp := covidProbe.New(&stack.Cfg.Monitor, store, stack.PopulationStore, stack.NotificationStore)
+	run.Register(cp)
+	count, err := cp.Update(ctx)
+	stats := cp.Stats()
+	counts := &db.RunCounts{Fetched: stats.Fetched, Rejected: stats.Rejected, UnknownCountries: stats.UnknownCountries}
+	if err != nil {
+		return counts, fmt.Errorf("update COVID-19 figures: %w", err)
 	}
+	slog.Info("discovered country figures", "count", count, "duration", time.Since(start))
+	return counts, nil
 }
 
-func (stack *Stack) loadIfEmpty() bool {
-	if rows, err := stack.CovidStore.Rows(); err != nil {
-		slog.Error("could not access database", "err", err)
-		return false
+func (stack *Stack) loadIfEmpty(ctx context.Context, store *db.PGCovidStore) (bool, error) {
+	if rows, err := store.Rows(ctx); err != nil {
+		return false, fmt.Errorf("database: %w", err)
 	} else if rows > 0 {
-		return false
+		return false, nil
 	}
 
 	slog.Info("database is empty. backfilling ... ")
 
 	start := time.Now()
-	bf := backfill.New(stack.CovidStore)
-	if err := bf.Run(); err != nil {
-		slog.Error("failed to populate database", "err", err)
-		return false
+	bf := backfill.New(store)
+	if err := bf.Run(ctx); err != nil {
+		return false, fmt.Errorf("backfill: %w", err)
 	}
 
 	slog.Info("historic data loaded", "duration", time.Since(start))
-	return true
+	return true, nil
 }
 
-// LoadPopulation retrieves the latest population figures and stores them in the database
-func (stack *Stack) LoadPopulation() {
+// LoadPopulation retrieves the latest population figures and stores them in the database. If it fails, a failure notification is sent.
+func (stack *Stack) LoadPopulation(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "load population")
+	defer func() { _ = tracing.End(span, err) }()
+	run := NewRunMetrics("population", stack.Cfg.LoaderMetrics)
+	defer func() { run.Done(err) }()
+	if c, ok := stack.PopulationUpdater.(prometheus.Collector); ok {
+		run.Register(c)
+	}
+	_, endRun := stack.startRun(ctx, health.PopulationSource)
+	defer func() { endRun(nil, err) }()
+
 	start := time.Now()
-	cp := populationProbe.New(stack.Cfg.Monitor.RapidAPIKey, stack.PopulationStore)
-	if count, err := cp.Update(context.Background()); err == nil {
-		slog.Info("discovered country population figures", "count", count, "duration", time.Since(start))
-	} else {
-		slog.Error("failed to update population figures", "err", err)
+	count, err := stack.PopulationUpdater.Update(ctx)
+	if err != nil {
+		err = fmt.Errorf("update population figures (%d updated): %w", count, err)
+		stack.FailureNotifier.Notify("population", err)
+		return err
+	}
+	slog.Info("discovered country population figures", "count", count, "duration", time.Since(start))
+	stack.setLastLoad(ctx, health.PopulationSource)
+	return nil
+}
+
+// setLastLoad records the successful load of a data source, as reported by the /status endpoint
+func (stack *Stack) setLastLoad(ctx context.Context, source string) {
+	if err := stack.LoadStore.SetLastLoad(ctx, source, time.Now()); err != nil {
+		slog.Warn("failed to record last load", "source", source, "err", err)
 	}
 }
 
 // Describe implements the prometheus.Collector interface
 func (stack *Stack) Describe(descs chan<- *prometheus.Desc) {
 	stack.DB.Collector.Describe(descs)
+	if stack.ReadDB != nil && stack.ReadDB != stack.DB {
+		stack.ReadDB.Collector.Describe(descs)
+	}
 	stack.SimpleJSONServer.Describe(descs)
+	if c, ok := stack.PopulationUpdater.(prometheus.Collector); ok {
+		c.Describe(descs)
+	}
 }
 
 // Collect implements the prometheus.Collector interface
 func (stack *Stack) Collect(metrics chan<- prometheus.Metric) {
 	stack.DB.Collector.Collect(metrics)
+	if stack.ReadDB != nil && stack.ReadDB != stack.DB {
+		stack.ReadDB.Collector.Collect(metrics)
+	}
 	stack.SimpleJSONServer.Collect(metrics)
+	if c, ok := stack.PopulationUpdater.(prometheus.Collector); ok {
+		c.Collect(metrics)
+	}
 }
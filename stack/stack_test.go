@@ -0,0 +1,34 @@
+package stack_test
+
+import (
+	"context"
+	"github.com/clambin/covid19/configuration"
+	"github.com/clambin/covid19/internal/testtools/db/covid"
+	"github.com/clambin/covid19/internal/testtools/db/population"
+	"github.com/clambin/covid19/simplejsonserver"
+	"github.com/clambin/covid19/stack"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestStack_RunHandler(t *testing.T) {
+	s := stack.Stack{
+		Cfg:              &configuration.Configuration{},
+		SimpleJSONServer: simplejsonserver.New(&covid.FakeStore{}, &population.FakeStore{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() { errs <- s.RunHandler(ctx) }()
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-errs:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("handler didn't shut down")
+	}
+}
@@ -0,0 +1,40 @@
+// Package otelrapidapi creates OpenTelemetry spans for the calls to RapidAPI services.
+package otelrapidapi
+
+import (
+	"context"
+	"github.com/clambin/covid19/tracing"
+	"github.com/clambin/go-rapidapi"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// API creates a span for each call to a RapidAPI service
+type API struct {
+	rapidapi.API
+	Host string
+}
+
+var _ rapidapi.API = API{}
+
+// New creates a RapidAPI client for the host that creates a span for each call
+func New(host, apiKey string) API {
+	return API{API: rapidapi.New(host, apiKey), Host: host}
+}
+
+// Call calls the endpoint of the RapidAPI service
+func (a API) Call(endpoint string) ([]byte, error) {
+	return a.CallWithContext(context.Background(), endpoint)
+}
+
+// CallWithContext calls the endpoint of the RapidAPI service
+func (a API) CallWithContext(ctx context.Context, endpoint string) ([]byte, error) {
+	ctx, span := otel.Tracer("github.com/clambin/covid19/tracing/otelrapidapi").Start(ctx, "rapidapi "+a.Host,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.NetPeerName(a.Host), attribute.String("rapidapi.endpoint", endpoint)),
+	)
+	body, err := a.API.CallWithContext(ctx, endpoint)
+	return body, tracing.End(span, err)
+}
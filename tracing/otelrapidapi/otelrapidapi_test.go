@@ -0,0 +1,31 @@
+package otelrapidapi_test
+
+import (
+	"context"
+	"github.com/clambin/covid19/tracing/otelrapidapi"
+	"github.com/clambin/go-rapidapi/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func TestAPI(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	api := mocks.API{}
+	api.On("CallWithContext", mock.Anything, "/v1/stats").Return([]byte("{}"), nil).Once()
+
+	body, err := otelrapidapi.API{API: &api, Host: "example.com"}.CallWithContext(context.Background(), "/v1/stats")
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(body))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "rapidapi example.com", spans[0].Name())
+	api.AssertExpectations(t)
+}
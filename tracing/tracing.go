@@ -0,0 +1,74 @@
+// Package tracing exports OpenTelemetry traces of the SimpleJSON queries, the database calls and the calls to upstream APIs.
+//
+// Packages create their spans with the global tracer provider. Until Start installs a provider, spans are not recorded.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/clambin/covid19/configuration"
+	"github.com/clambin/covid19/version"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName identifies the application in the exported traces
+const ServiceName = "covid19"
+
+// Start installs a global tracer provider that exports traces as configured. The returned function flushes any
+// remaining spans and stops the exporter. If tracing is disabled, Start doesn't install a provider.
+func Start(ctx context.Context, cfg configuration.TracingConfiguration) (func(context.Context) error, error) {
+	exporter, err := newExporter(ctx, cfg)
+	if err != nil || exporter == nil {
+		return func(context.Context) error { return nil }, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(ServiceName),
+			semconv.ServiceVersion(version.BuildVersion),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, cfg configuration.TracingConfiguration) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case "":
+		return nil, nil
+	case configuration.TracingExporterStdout:
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case configuration.TracingExporterOTLP:
+		var options []otlptracegrpc.Option
+		if cfg.Endpoint != "" {
+			options = append(options, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, options...)
+	default:
+		return nil, fmt.Errorf("invalid exporter %q", cfg.Exporter)
+	}
+}
+
+// End records the error, if any, in the span and ends it. It returns the error, so it can be used in return statements
+func End(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+	return err
+}
@@ -0,0 +1,62 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"github.com/clambin/covid19/configuration"
+	"github.com/clambin/covid19/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     configuration.TracingConfiguration
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{name: "disabled", wantErr: assert.NoError},
+		{name: "stdout", cfg: configuration.TracingConfiguration{Exporter: "stdout", SampleRatio: 1}, wantErr: assert.NoError},
+		{name: "otlp", cfg: configuration.TracingConfiguration{Exporter: "otlp", Endpoint: "localhost:4317", Insecure: true, SampleRatio: 1}, wantErr: assert.NoError},
+		{name: "invalid", cfg: configuration.TracingConfiguration{Exporter: "jaeger"}, wantErr: assert.Error},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shutdown, err := tracing.Start(context.Background(), tt.cfg)
+			tt.wantErr(t, err)
+			assert.NoError(t, shutdown(context.Background()))
+		})
+	}
+}
+
+func TestEnd(t *testing.T) {
+	recorder := record(t)
+	tracer := otel.Tracer("test")
+
+	_, span := tracer.Start(context.Background(), "success")
+	assert.NoError(t, tracing.End(span, nil))
+	_, span = tracer.Start(context.Background(), "failure")
+	assert.Error(t, tracing.End(span, errors.New("fail")))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "fail", spans[1].Status().Description)
+}
+
+// record installs a tracer provider that records all spans until the test ends
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	current := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(current) })
+	return recorder
+}